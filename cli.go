@@ -4,9 +4,11 @@
 package main
 
 import (
-	"errors"
 	"os"
+	"path/filepath"
 	"strings"
+
+	seal "github.com/crasm/seal/lib"
 )
 
 const FileExtension = `.sl`
@@ -47,7 +49,7 @@ func determineInputOutput(cmd Command, inArg, outArg string) (in, out string, er
 		case Unwrap:
 			inferred := strings.TrimSuffix(in, FileExtension)
 			if inferred == in {
-				err = errors.New("output filename required")
+				err = usageError("output filename required")
 			}
 			out = inferred
 		default:
@@ -57,3 +59,19 @@ func determineInputOutput(cmd Command, inArg, outArg string) (in, out string, er
 
 	return in, out, err
 }
+
+// Returns the path a sealed file should be unwrapped to according to its
+// metadata, or "" if it has none. The file is put next to the seal.
+func metadataOutput(in string) string {
+	f, err := os.Open(in)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	sl, err := seal.ReadHeader(f)
+	if err != nil || sl.Metadata == nil {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(in), sl.Metadata.Name)
+}
@@ -57,7 +57,7 @@ func TestDetermineInputOutput(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		for cmd := Create; cmd <= Verify; cmd++ {
+		for cmd := Wrap; cmd <= Check; cmd++ {
 			in, out, err := determineInputOutput(cmd, c.givenIn, c.givenOut)
 			if err != nil {
 				t.Fatalf("expected nil, got %e", err)
@@ -79,14 +79,14 @@ func TestDetermineInputOutputInference(t *testing.T) {
 		expectedIn, expectedOut string
 	}{
 		{
-			command:     Create,
+			command:     Wrap,
 			givenIn:     "fileIn",
 			givenOut:    "",
 			expectedIn:  "fileIn",
 			expectedOut: "fileIn.sl",
 		},
 		{
-			command:     Extract,
+			command:     Unwrap,
 			givenIn:     "fileIn.sl",
 			givenOut:    "",
 			expectedIn:  "fileIn.sl",
@@ -107,10 +107,10 @@ func TestDetermineInputOutputInference(t *testing.T) {
 
 }
 
-func TestDetermineInputOutputExtractMissingExtension(t *testing.T) {
+func TestDetermineInputOutputUnwrapMissingExtension(t *testing.T) {
 	t.Parallel()
 
-	in, out, err := determineInputOutput(Extract, "fileIn", "")
+	in, out, err := determineInputOutput(Unwrap, "fileIn", "")
 	if err == nil {
 		t.Fatalf("expected an error, got in = '%s', out='%s'", in, out)
 	}
@@ -12,12 +12,19 @@ const (
 	Unwrap
 	Check
 	Dump
+	Repair
+	Info
+	Manifest
+	VerifyManifest
+	FromSums
+	ToSums
 )
 
 func getCommand() (Command, error) {
 	var cmd Command
 
-	if !isMutuallyExclusive(opt.Wrap, opt.Unwrap, opt.Check, opt.Dump) {
+	if !isMutuallyExclusive(opt.Wrap, opt.Unwrap, opt.Check, opt.Dump, opt.Repair, opt.Info,
+		opt.Manifest, opt.VerifyManifest, opt.FromSums, opt.ToSums) {
 		return cmd, errors.New("too many primary commands")
 	}
 
@@ -30,6 +37,18 @@ func getCommand() (Command, error) {
 		cmd = Check
 	case opt.Dump:
 		cmd = Dump
+	case opt.Repair:
+		cmd = Repair
+	case opt.Info:
+		cmd = Info
+	case opt.Manifest:
+		cmd = Manifest
+	case opt.VerifyManifest:
+		cmd = VerifyManifest
+	case opt.FromSums:
+		cmd = FromSums
+	case opt.ToSums:
+		cmd = ToSums
 	default:
 		return cmd, errors.New("no command specified")
 	}
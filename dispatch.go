@@ -4,10 +4,16 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"time"
 
 	seal "github.com/crasm/seal/lib"
 )
@@ -17,29 +23,304 @@ import (
 func dispatch(cmd Command, in, out *os.File) error {
 	var err error
 
+	// Library functions read the content from src, which reports progress.
+	// Chunked checks read `in` at random instead, and report to progress.
+	src, progress, done := withProgress(in)
+	defer done()
+
 	switch cmd {
 	case Wrap:
-		if out.Name() == os.Stdout.Name() {
-			_, err = seal.WrapBufferedBits(in, out, opt.Size)
-		} else {
-			_, err = seal.WrapBits(in, out, opt.Size)
+		err = wrap(in, src, out)
+		if err == nil {
+			err = preserveAttributes(in, out)
 		}
 
 	case Unwrap:
-		_, err = seal.Unwrap(in, out)
+		var sl *seal.UnwrappedSeal
+		switch {
+		case opt.Timid:
+			sl, err = unwrapTimid(in, src, out)
+		case opt.Lax:
+			// Hiding the size of the input skips checking it against
+			// the length in the header up front, so a truncated seal
+			// is extracted as far as it goes.
+			sl, err = unwrap(struct{ io.Reader }{src}, out)
+		default:
+			sl, err = unwrap(src, out)
+		}
+
+		// Salvaged content keeps its own mode and mtime, so it can't be
+		// mistaken for the original.
+		if opt.Lax && exitCode(err) == ExitBroken {
+			return &salvagedError{err}
+		}
+		if err == nil {
+			err = preserveAttributes(in, out)
+		}
+		if err == nil && sl.Metadata != nil && !opt.NoMeta &&
+			out.Name() != os.Stdout.Name() {
+			err = restoreMetadata(out, sl.Metadata)
+		}
 
 	case Check:
+		report := reporter(out)
+		var checked bool
+		checked, err = checkChunks(in, report, progress...)
+		if checked {
+			break
+		}
+
 		var sl *seal.UnwrappedSeal
-		sl, err = seal.Unwrap(in, ioutil.Discard)
-		fmt.Fprintf(out, "claim:  %v\nactual: %v\n",
-			hex.EncodeToString(sl.ClaimedSignature),
-			hex.EncodeToString(sl.CalculatedSignature))
+		sl, err = unwrap(src, ioutil.Discard)
+		if sl == nil {
+			break
+		}
+		if sl.Variant == seal.VariantSignify {
+			fmt.Fprintf(report, "claim:  %v\n",
+				base64.StdEncoding.EncodeToString(sl.ClaimedSignature))
+		} else {
+			fmt.Fprintf(report, "claim:  %v\nactual: %v\n",
+				hex.EncodeToString(sl.ClaimedSignature),
+				hex.EncodeToString(sl.CalculatedSignature))
+		}
+		printCorruption(report, err)
 
 	case Dump:
 		err = seal.DumpHeader(in, out)
+
+	case Info:
+		err = printInfo(in, out)
+
+	case Repair:
+		var repaired []seal.Range
+		repaired, err = seal.Repair(in, out)
+		for _, r := range repaired {
+			fmt.Fprintf(reporter(os.Stderr), "repaired: bytes %v (%d bytes)\n", r, r.Length)
+		}
 	default:
 		panic("no command specified")
 	}
 
 	return err
 }
+
+// Prints what the header of a sealed file says, without reading the content.
+// Returns an error if the header is malformed.
+func printInfo(in io.Reader, out io.Writer) error {
+	hi, err := seal.Inspect(in)
+	if err != nil {
+		return err
+	}
+
+	if opt.Format == FormatJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		enc.Encode(newInfoReport(hi))
+		return hi.Err
+	}
+
+	fmt.Fprintf(out, "header:  %s\n", hi.Header)
+	if !hi.WellFormed() {
+		fmt.Fprintf(out, "valid:   no (%v)\n", hi.Err)
+		return hi.Err
+	}
+
+	sl := hi.Seal
+	fmt.Fprintf(out, "magic:   %s\n", sl.Magic)
+	fmt.Fprintf(out, "version: %d\n", sl.Version)
+	fmt.Fprintf(out, "variant: %s\n", sl.VariantName())
+	if sl.TrailerLen > 0 {
+		fmt.Fprintf(out, "claim:   in trailer (%d bits)\n", hi.ClaimBits)
+	} else if v, err := seal.LookupVariant(sl.VariantName()); err == nil {
+		fmt.Fprintf(out, "claim:   %s (%d bits)\n",
+			v.EncodeClaim(sl.ClaimedSignature), hi.ClaimBits)
+	}
+	fmt.Fprintf(out, "header length:  %d\n", hi.HeaderLen)
+	fmt.Fprintf(out, "content offset: %d\n", hi.ContentOffset)
+
+	if sl.ChunkSize > 0 || sl.Metadata != nil {
+		fmt.Fprintf(out, "length:  %d\n", sl.Length)
+	}
+	if sl.ChunkSize > 0 {
+		fmt.Fprintf(out, "chunk:   %d\n", sl.ChunkSize)
+	}
+	if sl.Parity > 0 {
+		fmt.Fprintf(out, "parity:  %d\n", sl.Parity)
+	}
+	if m := sl.Metadata; m != nil {
+		fmt.Fprintf(out, "name:    %s\n", m.Name)
+		fmt.Fprintf(out, "mode:    %04o\n", uint32(m.Mode))
+		fmt.Fprintf(out, "mtime:   %s\n", m.ModTime.Format(time.RFC3339Nano))
+	}
+	fmt.Fprintf(out, "valid:   yes\n")
+	return nil
+}
+
+// Wraps src, which reads `in`, to out with the options given.
+func wrap(in *os.File, src io.Reader, out *os.File) error {
+	toStdout := out.Name() == os.Stdout.Name()
+	if opt.Sign != "" {
+		key, err := loadSecretKey(opt.Sign)
+		if err != nil {
+			return err
+		}
+		_, err = seal.Wrap(src, out, seal.WithSigner(key))
+		return err
+	}
+
+	algo := opt.Algo
+	if opt.Merkle {
+		algo = "merkle-" + opt.Algo
+	}
+	opts := []seal.Option{seal.WithAlgorithm(algo), seal.WithBits(opt.Size)}
+
+	// Metadata is recorded for regular files unless it's disabled, except
+	// when the seal is streamed to stdout.
+	meta := fileMetadata(in)
+	if toStdout {
+		meta = nil
+	} else if meta != nil && opt.Merkle {
+		return usageError("merkle seals can't record metadata; use --no-metadata")
+	}
+	if meta != nil {
+		opts = append(opts, seal.WithMetadata(meta))
+	}
+
+	switch {
+	case opt.Parity != "":
+		if toStdout {
+			return usageError("parity can't be written to stdout")
+		}
+		percent, err := parsePercent(opt.Parity)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, seal.WithChunk(opt.Chunk), seal.WithParity(percent))
+	case opt.Merkle:
+		if toStdout {
+			return usageError("merkle seals can't be written to stdout")
+		}
+		opts = append(opts, seal.WithChunk(opt.Chunk))
+	case opt.Table:
+		if toStdout {
+			return usageError("chunk tables can't be written to stdout")
+		}
+		opts = append(opts, seal.WithChunk(opt.Chunk))
+	case toStdout:
+		// Stdout may be a file, but one opened by the shell, which may
+		// not start at its beginning, so the seal is streamed with the
+		// trailer layout as it would be to a pipe.
+		_, err := seal.Wrap(src, struct{ io.Writer }{out}, opts...)
+		return err
+	}
+
+	_, err := seal.Wrap(src, out, opts...)
+	return err
+}
+
+// Checks a seal with a chunk table in a regular file chunk by chunk,
+// reporting the byte ranges of the content that are corrupt, and its progress
+// to opts. Returns false if `in` doesn't have a chunk table
+// or can't be read at random.
+func checkChunks(in *os.File, out io.Writer, opts ...seal.Option) (bool, error) {
+	info, err := in.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return false, nil
+	}
+
+	ra, err := seal.NewReaderAt(in, info.Size())
+	if err != nil {
+		return false, nil
+	}
+
+	err = ra.CheckContext(context.Background(), opts...)
+	fmt.Fprintf(out, "claim:  %v\n", hex.EncodeToString(ra.ClaimedSignature))
+	printCorruption(out, err)
+
+	return true, err
+}
+
+// Lists the corrupt byte ranges if err is a *seal.CorruptionError.
+func printCorruption(out io.Writer, err error) {
+	var cerr *seal.CorruptionError
+	if !errors.As(err, &cerr) {
+		return
+	}
+
+	for _, r := range cerr.Ranges {
+		fmt.Fprintf(out, "corrupt: bytes %v (%d bytes)\n", r, r.Length)
+	}
+}
+
+// Returns the metadata to record for `in`, or nil if it isn't a regular file
+// or metadata is disabled.
+func fileMetadata(in *os.File) *seal.Metadata {
+	if opt.NoMeta {
+		return nil
+	}
+
+	info, err := in.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	return seal.FileMetadata(info)
+}
+
+// Sets the mode and modification time of an unwrapped file from its seal.
+func restoreMetadata(out *os.File, meta *seal.Metadata) error {
+	err := out.Chmod(meta.Mode)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(out.Name(), meta.ModTime, meta.ModTime)
+}
+
+// Unwraps `in` without writing anything to `out` until the claim has been
+// verified. A regular file is read twice, and anything else is buffered in a
+// temporary file. The first read is from src, which reads `in`.
+func unwrapTimid(in *os.File, src io.Reader, out io.Writer) (*seal.UnwrappedSeal, error) {
+	info, err := in.Stat()
+	if err == nil && info.Mode().IsRegular() {
+		sl, err := unwrap(src, ioutil.Discard)
+		if err != nil {
+			return sl, err
+		}
+		_, err = in.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+		return unwrap(in, out)
+	}
+
+	tmp, err := ioutil.TempFile("", "seal-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sl, err := unwrap(src, tmp)
+	if err != nil {
+		return sl, err
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(out, tmp)
+	return sl, err
+}
+
+// Unwraps `in`, verifying the signature if a public key was given.
+func unwrap(in io.Reader, out io.Writer) (*seal.UnwrappedSeal, error) {
+	if opt.PubKey == "" {
+		return seal.Unwrap(in, out)
+	}
+
+	key, err := loadPublicKey(opt.PubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return seal.UnwrapSignify(in, out, key)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	seal "github.com/crasm/seal/lib"
+)
+
+func TestUnwrapTimid(t *testing.T) {
+	good := &bytes.Buffer{}
+	_, err := seal.WrapBuffered(bytes.NewBufferString("seal!\n"), good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := bytes.Replace(good.Bytes(), []byte("seal!"), []byte("seal?"), 1)
+
+	cases := []struct {
+		sealed []byte
+		pipe   bool // Read through a pipe rather than a regular file.
+		out    string
+		err    error
+	}{
+		{good.Bytes(), false, "seal!\n", nil},
+		{good.Bytes(), true, "seal!\n", nil},
+		{broken, false, "", seal.ErrSealBroken},
+		{broken, true, "", seal.ErrSealBroken},
+	}
+
+	for i, c := range cases {
+		in, err := sealedInput(c.sealed, c.pipe)
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+
+		out := &bytes.Buffer{}
+		_, err = unwrapTimid(in, in, out)
+		in.Close()
+		if err != c.err {
+			t.Errorf("case %d: expected error %v, got %v", i, c.err, err)
+		}
+		if out.String() != c.out {
+			t.Errorf("case %d: expected output %q, got %q", i, c.out, out.String())
+		}
+	}
+}
+
+// Returns a file to read `sealed` from.
+func sealedInput(sealed []byte, pipe bool) (*os.File, error) {
+	if !pipe {
+		f, err := ioutil.TempFile("", "seal-test-")
+		if err != nil {
+			return nil, err
+		}
+		os.Remove(f.Name())
+		f.Write(sealed)
+		_, err = f.Seek(0, 0)
+		return f, err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		w.Write(sealed)
+		w.Close()
+	}()
+	return r, nil
+}
+
+// Metadata is recorded with a chunk table or parity, but not in a merkle
+// seal, whose root can't cover it.
+func TestWrapMetadata(t *testing.T) {
+	saved := opt
+	defer func() { opt = saved }()
+
+	dir, err := ioutil.TempDir("", "seal-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "seal.txt")
+	err = ioutil.WriteFile(path, bytes.Repeat([]byte("seal!\n"), 100), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		table, merkle, noMeta bool
+		parity                string
+		meta                  bool
+		usage                 bool // Expect a usage error.
+	}{
+		{false, false, false, "", true, false},
+		{true, false, false, "", true, false},
+		{false, false, false, "10%", true, false},
+		{false, false, true, "10%", false, false},
+		{false, true, false, "", false, true},
+		{false, true, true, "", false, false},
+	}
+
+	for i, c := range cases {
+		opt.Algo, opt.Size, opt.Chunk = "sha256", 256, 64
+		opt.Table, opt.Merkle, opt.NoMeta, opt.Parity = c.table, c.merkle, c.noMeta, c.parity
+
+		in, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.TempFile(dir, "out-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = wrap(in, in, out)
+		in.Close()
+		var uerr usageError
+		if c.usage {
+			if !errors.As(err, &uerr) {
+				t.Errorf("case %d: expected a usage error, got %v", i, err)
+			}
+			out.Close()
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+			out.Close()
+			continue
+		}
+
+		_, err = out.Seek(0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sl, err := seal.Unwrap(out, ioutil.Discard)
+		out.Close()
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+			continue
+		}
+		if (sl.Metadata != nil) != c.meta {
+			t.Errorf("case %d: expected metadata %v, got %+v", i, c.meta, sl.Metadata)
+		} else if c.meta && (sl.Metadata.Name != "seal.txt" || sl.Metadata.Mode != 0640) {
+			t.Errorf("case %d: wrong metadata %+v", i, sl.Metadata)
+		}
+	}
+}
+
+// Chunked checks read the seal at random, and report their progress chunk by
+// chunk.
+func TestCheckChunksProgress(t *testing.T) {
+	sealed := &bytes.Buffer{}
+	_, err := seal.Wrap(bytes.NewReader(bytes.Repeat([]byte("seal!"), 100)), sealed,
+		seal.WithAlgorithm("sha256"), seal.WithChunk(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := sealedInput(sealed.Bytes(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	var calls int
+	var done, total int64
+	progress := seal.WithProgress(func(d, t int64) {
+		calls, done, total = calls+1, d, t
+	})
+	checked, err := checkChunks(in, ioutil.Discard, progress)
+	if !checked || err != nil {
+		t.Fatalf("expected a valid chunked check, got %v, %v", checked, err)
+	}
+	if calls != 8 || done != 500 || total != 500 {
+		t.Errorf("expected 8 calls ending at 500 of 500 bytes, got %d ending at %d of %d",
+			calls, done, total)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	seal "github.com/crasm/seal/lib"
+	"github.com/crasm/seal/lib/batch"
+	"github.com/crasm/seal/lib/manifest"
+)
+
+// Exit statuses. With more than one input, the highest status of any input
+// is used.
+const (
+	ExitOK        = 0 // Everything worked, and every claim held.
+	ExitBroken    = 1 // A claim did not hold, or the content was cut short.
+	ExitMalformed = 2 // A header was malformed or unsupported.
+	ExitIO        = 3 // A file couldn't be read or written.
+	ExitUsage     = 4 // The options or inputs given don't make sense.
+)
+
+// usageError is an error in how seal was invoked.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// salvagedError is what --lax returns when it extracts content that didn't
+// verify. The output is kept, but the exit status is that of err.
+type salvagedError struct {
+	err error
+}
+
+func (e *salvagedError) Error() string {
+	return "salvaged unverified content: " + e.err.Error()
+}
+
+func (e *salvagedError) Unwrap() error {
+	return e.err
+}
+
+// Errors from the library that mean the options given don't fit the seal.
+var usageErrors = []error{
+	seal.ErrBadChunkSize,
+	seal.ErrBadParity,
+	seal.ErrBadPassphrase,
+	seal.ErrBadSignatureLength,
+	seal.ErrNoParity,
+	seal.ErrNotChunked,
+	seal.ErrNotSigned,
+	seal.ErrPassphraseRequired,
+	seal.ErrPublicKeyRequired,
+	seal.ErrUnknownAlgorithm,
+	seal.ErrUnknownVariant,
+	seal.ErrWrongKey,
+	os.ErrExist, // The output exists, and --force wasn't given.
+}
+
+// Returns the exit status for the outcome of running a command.
+func exitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	// Check for malformed headers first, since their cause may be a usage
+	// error like an unknown variant.
+	if errors.Is(err, seal.ErrMalformedHeader) || errors.Is(err, manifest.ErrMalformed) {
+		return ExitMalformed
+	}
+
+	if batch.IsBroken(err) || errors.Is(err, manifest.ErrBadRoot) {
+		return ExitBroken
+	}
+
+	var uerr usageError
+	if errors.As(err, &uerr) {
+		return ExitUsage
+	}
+	for _, target := range usageErrors {
+		if errors.Is(err, target) {
+			return ExitUsage
+		}
+	}
+
+	return ExitIO
+}
+
+// Returns w, or a writer that discards everything if --quiet is given. Used
+// for output that only reports how a command went.
+func reporter(w io.Writer) io.Writer {
+	if opt.Quiet {
+		return ioutil.Discard
+	}
+	return w
+}
+
+// Prints err, unless --quiet is given, and exits with its status.
+func fail(err error) {
+	if !opt.Quiet {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	seal "github.com/crasm/seal/lib"
+)
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+
+	_, malformed := seal.ReadHeader(strings.NewReader("SL%v0{md5:cf83e135}\n"))
+	_, missing := os.Open("does/not/exist")
+
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{nil, ExitOK},
+		{seal.ErrSealBroken, ExitBroken},
+		{&seal.CorruptionError{}, ExitBroken},
+		{fmt.Errorf("wrapped: %w", io.ErrUnexpectedEOF), ExitBroken},
+		{malformed, ExitMalformed},
+		{missing, ExitIO},
+		{seal.ErrPublicKeyRequired, ExitUsage},
+		{usageError("output filename required"), ExitUsage},
+	}
+
+	for i, c := range cases {
+		code := exitCode(c.err)
+		if code != c.code {
+			t.Errorf("case %d: expected %d, got %d (%v)", i, c.code, code, c.err)
+		}
+	}
+}
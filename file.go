@@ -3,31 +3,146 @@
 
 package main
 
-import "os"
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
 
 const DefaultPerm = 0644
 
-func openInputOutput(cmd Command, force bool, in, out string) (inFile, outFile *os.File, err error) {
+// outputFile is where a command writes its output. Unless the output is
+// stdout, it's a temporary file next to the output path, which finish renames
+// into place once the command has succeeded. A failed or interrupted command
+// never leaves a partial output behind or clobbers an existing file.
+type outputFile struct {
+	*os.File
+	path string // Empty for stdout.
+}
+
+func openInputOutput(cmd Command, force bool, in, out string) (inFile *os.File, outFile *outputFile, err error) {
 	inFile, err = os.Open(in)
 	if err != nil {
 		return
 	}
 
+	outFile, err = createOutput(out, force)
+	return
+}
+
+// Opens an output, which is stdout or a temporary file that finish renames to
+// out. The result is never nil.
+func createOutput(out string, force bool) (*outputFile, error) {
+	var err error
+	outFile := &outputFile{}
 	if out == os.Stdout.Name() {
-		outFile, err = os.OpenFile(out, os.O_WRONLY|os.O_APPEND, DefaultPerm)
-		return
+		outFile.File, err = os.OpenFile(out, os.O_WRONLY|os.O_APPEND, DefaultPerm)
+		return outFile, err
 	}
 
 	// If we got here, we're actually creating a new file!
 
-	callopt := os.O_CREATE | os.O_RDWR
-	if force {
-		callopt |= os.O_TRUNC
-	} else {
-		callopt |= os.O_EXCL
+	if !force {
+		_, err = os.Lstat(out)
+		if err == nil {
+			return outFile, &os.PathError{Op: "open", Path: out, Err: os.ErrExist}
+		}
+		if !os.IsNotExist(err) {
+			return outFile, err
+		}
 	}
 
-	outFile, err = os.OpenFile(out, callopt, DefaultPerm)
+	outFile.File, err = createTemp(out)
+	outFile.path = out
+	return outFile, err
+}
 
-	return
+// Creates a new file in the same directory as path, so it can be renamed to
+// path.
+func createTemp(path string) (*os.File, error) {
+	dir, base := filepath.Split(path)
+	for i := 0; ; i++ {
+		name := filepath.Join(dir, fmt.Sprintf(".%s.%08x.tmp", base, rand.Uint32()))
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_RDWR, DefaultPerm)
+		if os.IsExist(err) && i < 100 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// Gives `to` the mode and modification time of `from` if both are regular
+// files, unless --no-preserve is given. With --in-place, the owner is kept
+// too. Stdin and stdout are left alone even if the shell redirected them to
+// files, since the files aren't seal's to change.
+func preserveAttributes(from, to *os.File) error {
+	if opt.NoPreserve || from.Name() == stdin || to.Name() == stdout {
+		return nil
+	}
+
+	info, err := from.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return err
+	}
+	toInfo, err := to.Stat()
+	if err != nil || !toInfo.Mode().IsRegular() {
+		return err
+	}
+
+	if opt.InPlace {
+		preserveOwner(info, to)
+	}
+	err = to.Chmod(info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(to.Name(), info.ModTime(), info.ModTime())
+}
+
+// Closes the output. If err is nil, the output is synced to disk and renamed
+// into place, and otherwise it is removed, unless err is a *salvagedError.
+// Returns err, or the first error from finishing the output.
+func (f *outputFile) finish(err error) error {
+	if f.File == nil {
+		return err
+	}
+
+	// Salvaged content is kept, but is still reported as broken.
+	var serr *salvagedError
+	if errors.As(err, &serr) {
+		ferr := f.finish(nil)
+		if ferr != nil {
+			return ferr
+		}
+		return err
+	}
+	if f.path == "" {
+		f.Close()
+		return err
+	}
+
+	if err == nil {
+		err = f.Sync()
+	}
+	cerr := f.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	// Make the rename durable. Not every system can sync a directory.
+	dir, derr := os.Open(filepath.Dir(f.path))
+	if derr == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
 }
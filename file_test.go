@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOutputFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seal-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "in")
+	out := filepath.Join(dir, "out")
+	ioutil.WriteFile(in, nil, DefaultPerm)
+	ioutil.WriteFile(out, []byte("original"), DefaultPerm)
+
+	cases := []struct {
+		force    bool
+		err      error
+		expected string
+	}{
+		{false, nil, "original"}, // Refuses to open an existing output.
+		{true, errors.New("failed"), "original"},
+		{true, nil, "replaced"},
+	}
+
+	for i, c := range cases {
+		inFile, outFile, err := openInputOutput(Wrap, c.force, in, out)
+		inFile.Close()
+		if !c.force {
+			if !os.IsExist(err) {
+				t.Errorf("case %d: expected an existing file error, got %v", i, err)
+			}
+		} else {
+			if err != nil {
+				t.Fatalf("case %d: %v", i, err)
+			}
+			outFile.WriteString("replaced")
+			err = outFile.finish(c.err)
+			if err != c.err {
+				t.Errorf("case %d: expected %v, got %v", i, c.err, err)
+			}
+		}
+
+		data, _ := ioutil.ReadFile(out)
+		if string(data) != c.expected {
+			t.Errorf("case %d: expected %q, got %q", i, c.expected, data)
+		}
+		files, _ := ioutil.ReadDir(dir)
+		if len(files) != 2 {
+			t.Errorf("case %d: expected only in and out, got %d files", i, len(files))
+		}
+	}
+}
+
+func TestPreserveAttributes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seal-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mtime := time.Date(2016, 7, 4, 12, 30, 0, 0, time.UTC)
+	from, _ := os.Create(filepath.Join(dir, "from"))
+	defer from.Close()
+	from.Chmod(0750)
+	os.Chtimes(from.Name(), mtime, mtime)
+
+	to, _ := os.Create(filepath.Join(dir, "to"))
+	defer to.Close()
+
+	err = preserveAttributes(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := to.Stat()
+	if info.Mode().Perm() != 0750 {
+		t.Errorf("expected mode 0750, got %04o", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %v, got %v", mtime, info.ModTime())
+	}
+
+	// Regular files the shell redirected stdin or stdout to are left alone.
+	defer func(in, out string) { stdin, stdout = in, out }(stdin, stdout)
+	other, _ := os.Create(filepath.Join(dir, "other"))
+	defer other.Close()
+	other.Chmod(0600)
+
+	for i, c := range [][2]string{{from.Name(), stdout}, {stdin, other.Name()}} {
+		stdin, stdout = c[0], c[1]
+		err = preserveAttributes(from, other)
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		info, _ := other.Stat()
+		if info.Mode().Perm() != 0600 || info.ModTime().Equal(mtime) {
+			t.Errorf("case %d: expected the redirected file to be left alone", i)
+		}
+	}
+}
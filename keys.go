@@ -0,0 +1,70 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	seal "github.com/crasm/seal/lib"
+	"golang.org/x/term"
+)
+
+// The secret key is kept once loaded, so the passphrase is only asked for
+// once when sealing many files.
+var secretKeys = map[string]*seal.SecretKey{}
+
+// Loads a signify secret key, prompting for the passphrase on the terminal
+// if the key is encrypted.
+func loadSecretKey(path string) (*seal.SecretKey, error) {
+	if key, ok := secretKeys[path]; ok {
+		return key, nil
+	}
+
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := seal.ParseSecretKey(file, nil)
+	if err == seal.ErrPassphraseRequired {
+		var pass []byte
+		pass, err = readPassphrase()
+		if err != nil {
+			return nil, err
+		}
+		key, err = seal.ParseSecretKey(file, pass)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secretKeys[path] = key
+	return key, nil
+}
+
+func loadPublicKey(path string) (*seal.PublicKey, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return seal.ParsePublicKey(file)
+}
+
+// Reads a passphrase from the controlling terminal, like signify does.
+func readPassphrase() ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't read passphrase: %v", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, "passphrase: ")
+	pass, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+
+	return pass, err
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import (
+	"crypto/sha256"
+	"crypto/sha3"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/blake2b"
+	"lukechampine.com/blake3"
+)
+
+// Variants backed by the built-in hash algorithms. Like sha512, their claims
+// are hex-encoded and may be truncated.
+const (
+	VariantSHA256  = "sha256"
+	VariantSHA3    = "sha3-512"
+	VariantBLAKE2b = "blake2b"
+	VariantBLAKE3  = "blake3"
+)
+
+var ErrUnknownAlgorithm = errors.New("seal: unknown hash algorithm")
+
+// Algorithm is a hash function that can be used to seal content.
+type Algorithm struct {
+	Name string
+	New  func() hash.Hash
+
+	// The largest claim, in bytes. Claims may be truncated to any whole
+	// number of bytes up to this size.
+	MaxBytes int
+}
+
+var algorithms = map[string]*Algorithm{}
+
+// Registers a hash algorithm under the given variant name, along with a
+// variant whose claim is a hex-encoded digest of at most maxBytes and a
+// merkle variant using the algorithm. The algorithm must produce maxBytes
+// sized digests.
+func RegisterAlgorithm(name string, new func() hash.Hash, maxBytes int) {
+	RegisterVariant(hexVariant(name, maxBytes))
+	RegisterVariant(treeVariant(name, maxBytes))
+	algorithms[name] = &Algorithm{Name: name, New: new, MaxBytes: maxBytes}
+}
+
+// Returns the registered hash algorithm with the given variant name.
+func LookupAlgorithm(name string) (*Algorithm, error) {
+	algo, ok := algorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, name)
+	}
+	return algo, nil
+}
+
+func init() {
+	RegisterAlgorithm(VariantSHA512, sha512.New, sha512.Size)
+	RegisterAlgorithm(VariantSHA256, sha256.New, sha256.Size)
+	RegisterAlgorithm(VariantSHA3, func() hash.Hash { return sha3.New512() }, 64)
+	RegisterAlgorithm(VariantBLAKE2b, func() hash.Hash {
+		h, _ := blake2b.New512(nil) // Only fails for oversized keys.
+		return h
+	}, blake2b.Size)
+	RegisterAlgorithm(VariantBLAKE3, func() hash.Hash {
+		return blake3.New(32, nil)
+	}, 32)
+}
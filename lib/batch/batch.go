@@ -0,0 +1,193 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+// Package batch verifies many sealed files concurrently.
+package batch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	seal "github.com/crasm/seal/lib"
+)
+
+// Result is the outcome of verifying one sealed file.
+type Result struct {
+	Path string
+
+	// Seal is nil if the header couldn't be read. Otherwise its
+	// CalculatedSignature is set once the content has been read.
+	Seal *seal.UnwrappedSeal
+
+	Bytes    int64 // Bytes of content hashed.
+	Duration time.Duration
+	Err      error
+}
+
+// Returns true if the file was read but its seal did not hold.
+func (r *Result) Broken() bool {
+	return IsBroken(r.Err)
+}
+
+// Errors that mean a seal was read, but its content doesn't match it.
+var brokenErrors = []error{
+	seal.ErrSealBroken,
+	seal.ErrBadChunkTable,
+	seal.ErrTrailingData,
+	seal.ErrUnrepairable,
+	io.ErrUnexpectedEOF,
+}
+
+// Reports whether err means a seal was read but didn't hold: its claim
+// failed, or its content was cut short or followed by more. A malformed
+// header isn't broken, whatever its cause.
+func IsBroken(err error) bool {
+	if errors.Is(err, seal.ErrMalformedHeader) {
+		return false
+	}
+	for _, target := range brokenErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Totals summarizes the results of a batch.
+type Totals struct {
+	Files   int
+	OK      int
+	Broken  int
+	Errored int
+
+	Bytes   int64
+	Elapsed time.Duration
+}
+
+// Returns the bytes of content hashed per second.
+func (t *Totals) Throughput() float64 {
+	if t.Elapsed <= 0 {
+		return 0
+	}
+	return float64(t.Bytes) / t.Elapsed.Seconds()
+}
+
+func (t *Totals) add(r *Result) {
+	t.Files++
+	t.Bytes += r.Bytes
+	switch {
+	case r.Err == nil:
+		t.OK++
+	case r.Broken():
+		t.Broken++
+	default:
+		t.Errored++
+	}
+}
+
+// Verifier verifies sealed files with a bounded number of workers.
+type Verifier struct {
+	// Workers is the number of files verified at once. It defaults to the
+	// number of CPUs.
+	Workers int
+
+	// PublicKey is used for signify seals, which fail with
+	// seal.ErrPublicKeyRequired without one.
+	PublicKey *seal.PublicKey
+}
+
+// Verifies the file at each path received from paths, sending a Result to
+// results as each one finishes. Returns the totals once paths is closed and
+// every result has been sent, or ctx.Err() once ctx is done, in which case
+// files being verified stop early. results is closed before Run returns.
+func (v *Verifier) Run(ctx context.Context, paths <-chan string, results chan<- Result) (*Totals, error) {
+	defer close(results)
+
+	workers := v.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	start := time.Now()
+	totals := &Totals{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				var path string
+				var ok bool
+				select {
+				case path, ok = <-paths:
+					if !ok {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+
+				r := v.verify(ctx, path)
+				if ctx.Err() != nil {
+					return
+				}
+
+				mu.Lock()
+				totals.add(&r)
+				mu.Unlock()
+
+				select {
+				case results <- r:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	totals.Elapsed = time.Since(start)
+	return totals, ctx.Err()
+}
+
+// Verifies a single file.
+func (v *Verifier) verify(ctx context.Context, path string) Result {
+	start := time.Now()
+	r := Result{Path: path}
+	r.Seal, r.Bytes, r.Err = v.unwrap(ctx, path)
+	r.Duration = time.Since(start)
+	return r
+}
+
+func (v *Verifier) unwrap(ctx context.Context, path string) (*seal.UnwrappedSeal, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	in := seal.NewContextReader(ctx, f)
+	r, err := seal.NewReader(in)
+	if err == seal.ErrPublicKeyRequired && v.PublicKey != nil {
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, 0, err
+		}
+		r, err = seal.NewSignifyReader(in, v.PublicKey)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The content is read, and each hash calculated, on separate goroutines.
+	n, err := r.WriteTo(ioutil.Discard)
+	return &r.UnwrappedSeal, n, err
+}
@@ -0,0 +1,152 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	seal "github.com/crasm/seal/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Seals content into dir/name, returning the path.
+func writeSeal(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	require.Nil(t, err)
+	defer f.Close()
+
+	_, err = seal.Wrap(bytes.NewBufferString(content), f)
+	require.Nil(t, err)
+	return path
+}
+
+func sendPaths(paths ...string) <-chan string {
+	c := make(chan string, len(paths))
+	for _, p := range paths {
+		c <- p
+	}
+	close(c)
+	return c
+}
+
+func TestVerifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seal")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	good := writeSeal(t, dir, "good.sl", "seal!")
+	empty := writeSeal(t, dir, "empty.sl", "")
+	broken := writeSeal(t, dir, "broken.sl", "seal?")
+	f, err := os.OpenFile(broken, os.O_WRONLY|os.O_APPEND, 0)
+	require.Nil(t, err)
+	f.WriteString("!")
+	f.Close()
+	missing := filepath.Join(dir, "missing.sl")
+
+	results := make(chan Result, 4)
+	v := &Verifier{Workers: 2}
+	totals, err := v.Run(context.Background(), sendPaths(good, empty, broken, missing), results)
+	require.Nil(t, err)
+
+	var got []Result
+	for r := range results {
+		got = append(got, r)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Path < got[j].Path })
+	require.Len(t, got, 4)
+
+	assert.Equal(t, broken, got[0].Path)
+	assert.True(t, got[0].Broken())
+	assert.Equal(t, int64(6), got[0].Bytes)
+	assert.Equal(t, empty, got[1].Path)
+	assert.Nil(t, got[1].Err)
+	assert.Equal(t, good, got[2].Path)
+	assert.Nil(t, got[2].Err)
+	assert.NotNil(t, got[2].Seal.CalculatedSignature)
+	assert.Equal(t, missing, got[3].Path)
+	assert.True(t, os.IsNotExist(got[3].Err))
+	assert.Nil(t, got[3].Seal)
+
+	assert.Equal(t, 4, totals.Files)
+	assert.Equal(t, 2, totals.OK)
+	assert.Equal(t, 1, totals.Broken)
+	assert.Equal(t, 1, totals.Errored)
+	assert.Equal(t, int64(11), totals.Bytes)
+}
+
+// Files that are cut short or followed by more data are broken.
+func TestVerifierTruncated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seal")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	truncated := filepath.Join(dir, "truncated.sl")
+	f, err := os.Create(truncated)
+	require.Nil(t, err)
+	_, err = seal.WrapChunked(bytes.NewBufferString("seal!"), f, seal.VariantSHA256, 256, 2)
+	require.Nil(t, err)
+	info, err := f.Stat()
+	require.Nil(t, err)
+	require.Nil(t, f.Truncate(info.Size()-1))
+	f.Close()
+
+	// Only a length in the header shows where the content ends.
+	trailing := filepath.Join(dir, "trailing.sl")
+	f, err = os.Create(trailing)
+	require.Nil(t, err)
+	meta := &seal.Metadata{Name: "trailing", Mode: 0644, ModTime: time.Unix(0, 0)}
+	_, err = seal.Wrap(bytes.NewBufferString("seal!"), f, seal.WithMetadata(meta))
+	require.Nil(t, err)
+	f.WriteString("!")
+	f.Close()
+
+	results := make(chan Result, 2)
+	totals, err := (&Verifier{}).Run(context.Background(), sendPaths(truncated, trailing), results)
+	require.Nil(t, err)
+	for r := range results {
+		assert.True(t, r.Broken(), "%s: %v", r.Path, r.Err)
+	}
+	assert.Equal(t, 2, totals.Broken)
+}
+
+// A header declaring a huge chunk size is an error, not an allocation.
+func TestVerifierChunkTooLarge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seal")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "huge.sl")
+	header := "SL%v0{merkle-sha256:" + strings.Repeat("00", 32) + "} chunk=4611686018427387904 length=0000000000000000006\n"
+	require.Nil(t, ioutil.WriteFile(path, []byte(header+"seal!\n"), 0644))
+
+	results := make(chan Result, 1)
+	totals, err := (&Verifier{}).Run(context.Background(), sendPaths(path), results)
+	require.Nil(t, err)
+
+	r := <-results
+	assert.True(t, errors.Is(r.Err, seal.ErrChunkTooLarge), "%v", r.Err)
+	assert.False(t, r.Broken())
+	assert.Equal(t, 1, totals.Errored)
+}
+
+func TestVerifierCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := make(chan Result)
+	paths := make(chan string) // Never closed.
+	_, err := (&Verifier{}).Run(ctx, paths, results)
+	assert.Equal(t, context.Canceled, err)
+
+	_, ok := <-results
+	assert.False(t, ok)
+}
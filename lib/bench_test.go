@@ -0,0 +1,126 @@
+package seal
+
+import (
+	"bufio"
+	"crypto/sha512"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Compare the throughput of wrapping and unwrapping to that of copying with
+// io.Copy, which is what seal costs on top of moving the bytes:
+//
+//	go test -run XXX -bench . -benchtime 10x
+const benchSize = 128 << 20
+
+// Returns a file of benchSize random bytes, and a file to write to.
+func benchFiles(b *testing.B) (in, out *os.File) {
+	dir := b.TempDir()
+	data := make([]byte, benchSize)
+	rand.New(rand.NewSource(1)).Read(data)
+	path := filepath.Join(dir, "in")
+	err := ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	in, err = os.OpenFile(path, os.O_RDWR, 0)
+	if err == nil {
+		out, err = os.Create(filepath.Join(dir, "out"))
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		in.Close()
+		out.Close()
+	})
+	return in, out
+}
+
+// Runs f b.N times on new files.
+func benchCopy(b *testing.B, f func(in io.Reader, out io.WriteSeeker) error) {
+	in, out := benchFiles(b)
+	benchCopyFiles(b, in, out, f)
+}
+
+// Runs f b.N times, from the start of each file.
+func benchCopyFiles(b *testing.B, in, out *os.File, f func(in io.Reader, out io.WriteSeeker) error) {
+	b.SetBytes(benchSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := in.Seek(0, io.SeekStart)
+		if err == nil {
+			_, err = out.Seek(0, io.SeekStart)
+		}
+		if err == nil {
+			err = f(in, out)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The baseline. The file is hidden behind a plain Reader so that io.Copy
+// doesn't use copy_file_range, which seal can't.
+func BenchmarkCopy(b *testing.B) {
+	benchCopy(b, func(in io.Reader, out io.WriteSeeker) error {
+		_, err := io.CopyBuffer(out, struct{ io.Reader }{in}, make([]byte, defaultBufferSize))
+		return err
+	})
+}
+
+func BenchmarkWrap(b *testing.B) {
+	for _, algo := range fuzzAlgorithms {
+		b.Run(algo, func(b *testing.B) {
+			benchCopy(b, func(in io.Reader, out io.WriteSeeker) error {
+				_, err := Wrap(in, out, WithAlgorithm(algo))
+				return err
+			})
+		})
+	}
+
+	// How the content was copied before reading, writing and hashing were
+	// pipelined.
+	b.Run("sha512-serial", func(b *testing.B) {
+		benchCopy(b, func(in io.Reader, out io.WriteSeeker) error {
+			_, err := bufio.NewReader(io.TeeReader(in, out)).WriteTo(sha512.New())
+			return err
+		})
+	})
+
+	b.Run("merkle-sha256", func(b *testing.B) {
+		benchCopy(b, func(in io.Reader, out io.WriteSeeker) error {
+			_, err := WrapMerkle(in, out, VariantSHA256, DefaultChunkSize)
+			return err
+		})
+	})
+}
+
+func BenchmarkUnwrap(b *testing.B) {
+	for _, algo := range append(fuzzAlgorithms, treePrefix+VariantSHA256) {
+		b.Run(algo, func(b *testing.B) {
+			// The content is sealed, then unwrapped back over itself.
+			content, sealed := benchFiles(b)
+			var err error
+			if isTreeVariant(algo) {
+				_, err = WrapMerkle(content, sealed, VariantSHA256, DefaultChunkSize)
+			} else {
+				_, err = Wrap(content, sealed, WithAlgorithm(algo))
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			benchCopyFiles(b, sealed, content, func(in io.Reader, out io.WriteSeeker) error {
+				_, err := Unwrap(in, out)
+				return err
+			})
+		})
+	}
+}
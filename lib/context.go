@@ -0,0 +1,114 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// Returns a Reader that reads from `in` until ctx is done, then returns
+// ctx.Err(), and reports its progress to the function given with WithProgress.
+// Other options don't apply. Cancellation is noticed between reads, so a read
+// that blocks isn't interrupted. The size of `in` is known if it's a regular
+// file or has a Len method, like *bytes.Reader.
+//
+// The context-aware functions wrap their input with it, and it can be used to
+// add cancellation and progress to any of the others.
+func NewContextReader(ctx context.Context, in io.Reader, opts ...Option) io.Reader {
+	return newContextReader(ctx, in, newWrapConfig(opts).progress)
+}
+
+func newContextReader(ctx context.Context, in io.Reader, progress func(done, total int64)) io.Reader {
+	r := &ctxReader{ctx: ctx, in: in, progress: progress, total: -1}
+	if progress != nil {
+		r.total = inputSize(in)
+	}
+	return r
+}
+
+// Returns `in`, made to stop once the context given with WithContext is done
+// and to report to WithProgress, if either was given.
+func (c *wrapConfig) input(in io.Reader) io.Reader {
+	if c.ctx == nil && c.progress == nil {
+		return in
+	}
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return newContextReader(ctx, in, c.progress)
+}
+
+// ctxReader stops reading once its context is done.
+type ctxReader struct {
+	ctx      context.Context
+	in       io.Reader
+	progress func(done, total int64)
+	done     int64
+	total    int64
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	err := r.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := r.in.Read(p)
+	r.done += int64(n)
+	if r.progress != nil {
+		r.progress(r.done, r.total)
+	}
+	return n, err
+}
+
+// Returns the number of bytes left in `in`, or -1 if it can't be known
+// without reading it.
+func inputSize(in io.Reader) int64 {
+	switch in := in.(type) {
+	case *os.File:
+		info, err := in.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		offset, err := in.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return info.Size() - offset
+	case interface{ Len() int }:
+		return int64(in.Len())
+	case *ctxReader:
+		return inputSize(in.in)
+	}
+	return -1
+}
+
+// Same as Wrap with WithContext(ctx) given last.
+func WrapContext(ctx context.Context, in io.Reader, out io.Writer, opts ...Option) (*Seal, error) {
+	return Wrap(in, out, append(opts[:len(opts):len(opts)], WithContext(ctx))...)
+}
+
+// Same as Unwrap, but stops once ctx is done, and reports the progress of
+// reading `in`, including the header, to WithProgress. Other options don't
+// apply.
+func UnwrapContext(ctx context.Context, in io.Reader, out io.Writer, opts ...Option) (*UnwrappedSeal, error) {
+	return Unwrap(NewContextReader(ctx, in, opts...), out)
+}
+
+// Same as UnwrapSignify, but stops once ctx is done, and reports the progress
+// of reading `in`, including the header, to WithProgress. Other options don't
+// apply.
+func UnwrapSignifyContext(ctx context.Context, in io.Reader, out io.Writer, key *PublicKey, opts ...Option) (*UnwrappedSeal, error) {
+	return UnwrapSignify(NewContextReader(ctx, in, opts...), out, key)
+}
+
+// Same as Check, but stops once ctx is done, and reports the progress of
+// checking the content, chunk by chunk, to WithProgress. The total is the
+// length of the content rather than of the seal. Other options don't apply.
+func (ra *ReaderAt) CheckContext(ctx context.Context, opts ...Option) error {
+	return ra.check(ctx, newWrapConfig(opts).progress)
+}
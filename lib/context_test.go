@@ -0,0 +1,141 @@
+package seal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapContext(t *testing.T) {
+	f, err := ioutil.TempFile("", "seal-context-")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var done, total []int64
+	progress := WithProgress(func(d, t int64) {
+		done = append(done, d)
+		total = append(total, t)
+	})
+	_, err = WrapContext(context.Background(), strings.NewReader(vectorContent), f,
+		WithAlgorithm(VariantSHA256), progress)
+	require.Nil(t, err)
+	require.NotEmpty(t, done)
+	assert.Equal(t, int64(len(vectorContent)), done[len(done)-1])
+	assert.Equal(t, int64(len(vectorContent)), total[0])
+
+	// Unwrapping reports the progress of reading the whole seal.
+	done, total = nil, nil
+	_, err = f.Seek(0, io.SeekStart)
+	require.Nil(t, err)
+	out := &bytes.Buffer{}
+	_, err = UnwrapContext(context.Background(), f, out, progress)
+	require.Nil(t, err)
+	assert.Equal(t, vectorContent, out.String())
+	info, err := f.Stat()
+	require.Nil(t, err)
+	assert.Equal(t, info.Size(), done[len(done)-1])
+	assert.Equal(t, info.Size(), total[len(total)-1])
+}
+
+func TestWrapContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	f, err := ioutil.TempFile("", "seal-context-")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = WrapContext(ctx, strings.NewReader(vectorContent), f, WithAlgorithm(VariantSHA256))
+	assert.Equal(t, context.Canceled, err)
+
+	wrapped := &bytes.Buffer{}
+	_, err = WrapBufferedWith(strings.NewReader(vectorContent), wrapped, VariantSHA256, 256)
+	require.Nil(t, err)
+	_, err = UnwrapContext(ctx, wrapped, ioutil.Discard)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestWrapContextOptions(t *testing.T) {
+	// Any option can be given, and the output doesn't need to seek.
+	content := strings.Repeat("seal!", 1000)
+	var done int64
+	sealed := &bytes.Buffer{}
+	sl, err := WrapContext(context.Background(), strings.NewReader(content), sealed,
+		WithMetadata(testMeta), WithChunk(256), WithParity(10), WithBufferSize(64),
+		WithProgress(func(d, _ int64) { done = d }))
+	require.Nil(t, err)
+	assert.Equal(t, int64(len(content)), done)
+	assert.Equal(t, int64(256), sl.ChunkSize)
+
+	out := &bytes.Buffer{}
+	usl, err := Unwrap(bytes.NewReader(sealed.Bytes()), out)
+	require.Nil(t, err)
+	assert.Equal(t, content, out.String())
+	assert.Equal(t, testMeta.Name, usl.Metadata.Name)
+
+	// The context given to WrapContext is used over one given with
+	// WithContext.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = WrapContext(ctx, strings.NewReader(content), &bytes.Buffer{},
+		WithContext(context.Background()))
+	assert.Equal(t, context.Canceled, err)
+	_, err = Wrap(strings.NewReader(content), &bytes.Buffer{}, WithContext(ctx))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestContextReaderCancel(t *testing.T) {
+	// Reading stops at the next read once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewContextReader(ctx, strings.NewReader(vectorContent), WithProgress(func(done, total int64) {
+		if done >= 4 {
+			cancel()
+		}
+	}))
+
+	n, err := io.Copy(ioutil.Discard, io.LimitReader(r, 1<<20))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, int64(len(vectorContent)), n)
+
+	// A pipe has no known size.
+	pr, pw := io.Pipe()
+	go pw.Close()
+	var total int64
+	NewContextReader(context.Background(), pr, WithProgress(func(_, t int64) {
+		total = t
+	})).Read(make([]byte, 1))
+	assert.Equal(t, int64(-1), total)
+}
+
+func TestCheckContext(t *testing.T) {
+	content := strings.Repeat("seal!", 100)
+	sealed := &bytes.Buffer{}
+	_, err := Wrap(strings.NewReader(content), sealed, WithAlgorithm(VariantSHA256), WithChunk(16))
+	require.Nil(t, err)
+	ra, err := NewReaderAt(bytes.NewReader(sealed.Bytes()), int64(sealed.Len()))
+	require.Nil(t, err)
+
+	// Progress is reported once for each of the 32 chunks.
+	var done, total []int64
+	progress := WithProgress(func(d, t int64) {
+		done = append(done, d)
+		total = append(total, t)
+	})
+	require.Nil(t, ra.CheckContext(context.Background(), progress))
+	require.Len(t, done, 32)
+	assert.Equal(t, int64(16), done[0])
+	assert.Equal(t, int64(len(content)), done[31])
+	assert.Equal(t, int64(len(content)), total[0])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, ra.CheckContext(ctx))
+}
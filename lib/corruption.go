@@ -0,0 +1,78 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Range is a span of bytes in the sealed content.
+type Range struct {
+	Offset int64
+	Length int64
+}
+
+func (r Range) String() string {
+	return fmt.Sprintf("%d-%d", r.Offset, r.Offset+r.Length-1)
+}
+
+// CorruptionError is returned instead of ErrSealBroken when a chunk table
+// shows which parts of the content are corrupt. It matches ErrSealBroken
+// with errors.Is.
+type CorruptionError struct {
+	Ranges []Range
+}
+
+func (e *CorruptionError) Error() string {
+	ranges := make([]string, len(e.Ranges))
+	for i, r := range e.Ranges {
+		ranges[i] = r.String()
+	}
+	return fmt.Sprintf("%v: corrupt bytes %s", ErrSealBroken,
+		strings.Join(ranges, ", "))
+}
+
+func (e *CorruptionError) Is(target error) bool {
+	return target == ErrSealBroken
+}
+
+// Adds the chunk at off to a list of ranges, merging it with the last range
+// if they are adjacent.
+func addRange(ranges []Range, off, length int64) []Range {
+	if n := len(ranges); n > 0 && ranges[n-1].Offset+ranges[n-1].Length == off {
+		ranges[n-1].Length += length
+		return ranges
+	}
+	return append(ranges, Range{Offset: off, Length: length})
+}
+
+// Compares calculated chunk hashes against the chunk table of sl, returning
+// the ranges of content that don't match.
+func corruptRanges(sl *Seal, calc, table [][]byte) []Range {
+	var bad []Range
+	for i := range table {
+		if i < len(calc) && bytes.Equal(calc[i], table[i]) {
+			continue
+		}
+
+		off := int64(i) * sl.ChunkSize
+		length := sl.ChunkSize
+		if length > sl.Length-off {
+			length = sl.Length - off
+		}
+		bad = addRange(bad, off, length)
+	}
+	return bad
+}
+
+// Splits a chunk table into its hashes.
+func splitTable(table []byte, size int) [][]byte {
+	leaves := make([][]byte, len(table)/size)
+	for i := range leaves {
+		leaves[i] = table[i*size : (i+1)*size]
+	}
+	return leaves
+}
@@ -0,0 +1,90 @@
+package seal
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The algorithms a fuzzed byte selects between, in a fixed order.
+var fuzzAlgorithms = []string{
+	VariantSHA512,
+	VariantSHA256,
+	VariantSHA3,
+	VariantBLAKE2b,
+	VariantBLAKE3,
+}
+
+// Seeds the corpus with the files from goodCases and the test vectors.
+func addSealCorpus(f *testing.F) {
+	for _, c := range goodCases {
+		f.Add([]byte(c.header + c.data))
+	}
+	for _, dir := range []string{"good", "bad"} {
+		for _, data := range readVectors(f, dir) {
+			f.Add(data)
+		}
+	}
+}
+
+// Any header that parses must print as a header that parses to the same seal.
+func FuzzParseHeader(f *testing.F) {
+	addSealCorpus(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		sl, err := parseHeader(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			return
+		}
+
+		header := sl.String()
+		again, err := parseHeader(bufio.NewReader(bytes.NewReader([]byte(header))))
+		require.Nil(t, err, "%q", header)
+		assert.Equal(t, sl, again)
+		assert.Equal(t, header, again.String())
+	})
+}
+
+// Unwrap must not panic, however the file is damaged.
+func FuzzUnwrap(f *testing.F) {
+	addSealCorpus(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Unwrap(bytes.NewReader(data), ioutil.Discard)
+	})
+}
+
+// Anything wrapped must unwrap to the same content, both when the claim is in
+// the header and when it's in a trailer.
+func FuzzWrapUnwrap(f *testing.F) {
+	for _, c := range goodCases {
+		f.Add([]byte(c.data), uint8(0), uint8(c.bits/8-1))
+	}
+	f.Add([]byte(vectorContent), uint8(4), uint8(0))
+	f.Fuzz(func(t *testing.T, data []byte, algo, size uint8) {
+		a, err := LookupAlgorithm(fuzzAlgorithms[int(algo)%len(fuzzAlgorithms)])
+		require.Nil(t, err)
+		bits := (int(size)%a.MaxBytes + 1) * 8
+
+		wrapped := &bytes.Buffer{}
+		_, err = WrapBufferedWith(bytes.NewReader(data), wrapped, a.Name, bits)
+		require.Nil(t, err)
+		unwrapped := &bytes.Buffer{}
+		_, err = Unwrap(wrapped, unwrapped)
+		require.Nil(t, err)
+		assert.True(t, bytes.Equal(data, unwrapped.Bytes()))
+
+		wrapped.Reset()
+		w, err := NewWriterWith(wrapped, a.Name, bits)
+		require.Nil(t, err)
+		_, err = w.Write(data)
+		require.Nil(t, err)
+		require.Nil(t, w.Close())
+		unwrapped.Reset()
+		_, err = Unwrap(wrapped, unwrapped)
+		require.Nil(t, err)
+		assert.True(t, bytes.Equal(data, unwrapped.Bytes()))
+	})
+}
@@ -2,56 +2,365 @@ package seal
 
 import (
 	"bufio"
-	"encoding/hex"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
+	"strings"
 )
 
-// Returns the number of bytes in a header.
-func headerLen(bytes int) int {
-	// Hex encoding requires two bytes per byte, so we multiply by 2.
-	return IdentLen + len("{}\n") + bytes*2
+// ErrMalformedHeader matches every error returned because a header, or the
+// trailer of a seal using the trailer layout, couldn't be parsed.
+var ErrMalformedHeader = errors.New("seal: malformed header")
+
+// HeaderError is returned when a header can't be parsed. Err says why.
+type HeaderError struct {
+	Err error
+}
+
+func (e *HeaderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HeaderError) Unwrap() error {
+	return e.Err
+}
+
+// Returns true for ErrMalformedHeader.
+func (e *HeaderError) Is(target error) bool {
+	return target == ErrMalformedHeader
+}
+
+// The causes of a HeaderError, which can be matched with errors.Is.
+var (
+	ErrBadMagic           = errors.New("seal: bad magic number")
+	ErrUnsupportedVersion = errors.New("seal: unsupported version")
+	ErrMalformedClaim     = errors.New("seal: malformed claim")
+	ErrHeaderTooLong      = errors.New("seal: header is too long")
+	ErrChunkTooLarge      = errors.New("seal: chunk size is too large")
+)
+
+var errNoHeader = errors.New("seal: missing header line")
+
+// MaxHeaderLen is the most bytes read looking for the end of a header. The
+// longest legal header, with the longest claim, every attribute, a name of
+// maxNameLen bytes that are all escaped, and a CRLF line ending, is well
+// under this.
+const MaxHeaderLen = 4096
+
+// MaxChunkSize is the largest chunk size a header may declare. Readers hold
+// whole chunks in memory, so larger ones are rejected rather than trusted.
+const MaxChunkSize = 1 << 30
+
+// Returns the number of bytes in the header of a hex variant. The variant
+// is empty for the short form.
+func headerLen(variant string, bytes int) int {
+	n := IdentLen + len("{}\n") + bytes*2 // Two hex digits per byte.
+	if variant != "" {
+		n += len(variant) + len(":")
+	}
+	return n
 }
 
 // Parses the header of a seal file. Does not read beyond the
 // header.
 func parseHeader(in *bufio.Reader) (*Seal, error) {
-
-	// TODO: Stop reading and error out if we pass headerLen(maxBytes).
-	header, err := in.ReadBytes('\n')
+	header, err := readHeaderLine(in)
 	if err != nil {
 		return nil, err
 	}
+	return parseHeaderLine(header)
+}
 
-	sl := &Seal{}
+// Reads a header line, including its line ending, without reading more than
+// MaxHeaderLen bytes. If the line doesn't end, returns what was read along
+// with a *HeaderError, or io.EOF if nothing was.
+func readHeaderLine(in *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := in.ReadSlice('\n')
+		if len(line)+len(chunk) > MaxHeaderLen {
+			n := MaxHeaderLen - len(line)
+			return append(line, chunk[:n]...), &HeaderError{ErrHeaderTooLong}
+		}
+		line = append(line, chunk...)
 
-	sl.Magic = string(header[:len(Magic)]) // example: `SL%v`
-	if sl.Magic != Magic {
-		return nil, fmt.Errorf("seal: bad magic number: %q", sl.Magic)
+		switch {
+		case err == nil:
+			return line, nil
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && len(line) == 0:
+			return nil, &HeaderError{errNoHeader}
+		case err == io.EOF:
+			return line, &HeaderError{errNoHeader}
+		default:
+			return line, err
+		}
 	}
+}
+
+// Reads and parses the header of a seal without checking the claim. `in` may
+// be read past the header.
+func ReadHeader(in io.Reader) (*Seal, error) {
+	return parseHeader(bufio.NewReader(in))
+}
 
-	uint64Version, err := strconv.ParseUint(
-		string(header[len(Magic)]), 10, 8) // example: `0`
+// Parses a complete header line, including the newline. Errors are returned
+// as a *HeaderError.
+func parseHeaderLine(header []byte) (*Seal, error) {
+	sl, err := parseLine(header)
 	if err != nil {
-		return nil, fmt.Errorf("seal: couldn't parse version: %v", err)
+		return nil, &HeaderError{err}
+	}
+	return sl, nil
+}
+
+func parseLine(header []byte) (*Seal, error) {
+	if len(header) > MaxHeaderLen {
+		return nil, ErrHeaderTooLong
 	}
 
-	sl.Version = int(uint64Version)
+	// Both LF and CRLF line endings are allowed.
+	line := bytes.TrimSuffix(header, []byte("\n"))
+	if len(line) == len(header) {
+		return nil, errNoHeader
+	}
+	line = bytes.TrimSuffix(line, []byte("\r"))
+
+	sl := &Seal{}
+
+	if !bytes.HasPrefix(line, []byte(Magic)) {
+		n := len(Magic)
+		if len(line) < n {
+			n = len(line)
+		}
+		return nil, fmt.Errorf("%w: %q", ErrBadMagic, line[:n])
+	}
+	sl.Magic = Magic // example: `SL%v`
+
+	if len(line) < IdentLen {
+		return nil, fmt.Errorf("%w: missing version", ErrUnsupportedVersion)
+	}
+	v := line[len(Magic)] // example: `0`
+	if v < '0' || v > '9' {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedVersion, v)
+	}
+	sl.Version = int(v - '0')
 	if sl.Version != Version {
-		return nil, fmt.Errorf("seal: unsupported version: %v", sl.Version)
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, sl.Version)
+	}
+
+	// The claim is in braces, and is followed by the attributes.
+	sig := line[IdentLen:]
+	end := bytes.IndexByte(sig, '}')
+	if len(sig) < len("{x}") || sig[0] != '{' || end == -1 {
+		return nil, fmt.Errorf("%w: %q", ErrMalformedClaim, sig)
+	}
+	claim := sig[1:end]
+	if bytes.ContainsAny(claim, "{ \t\r") {
+		return nil, fmt.Errorf("%w: %q", ErrMalformedClaim, claim)
+	}
+
+	err := parseClaim(sl, string(claim))
+	if err != nil {
+		return nil, err
+	}
+
+	err = parseAttributes(sl, string(sig[end+1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateChunks(sl)
+	if err != nil {
+		return nil, err
+	}
+	err = validateMetadata(sl)
+	if err != nil {
+		return nil, err
+	}
+
+	return sl, nil
+}
+
+// Parses the inside of the braces, which is either the short form `<claim>`
+// or the long form `<variant>:<claim>`. A claim of `~<n>` marks a seal whose
+// n byte claim follows the content.
+func parseClaim(sl *Seal, claim string) error {
+	name := DefaultVariant
+	if i := strings.IndexByte(claim, ':'); i >= 0 {
+		name, claim = claim[:i], claim[i+1:]
+		sl.Variant = name
+	}
+
+	v, err := LookupVariant(name)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(claim, "~") {
+		n, err := strconv.ParseUint(claim[1:], 10, 16)
+		if err != nil {
+			return fmt.Errorf("%w: couldn't parse trailer length: %v", ErrMalformedClaim, err)
+		}
+		if !v.ValidClaimLen(int(n)) {
+			return ErrBadSignatureLength
+		}
+		sl.TrailerLen = int(n)
+		return nil
+	}
+
+	sl.ClaimedSignature, err = v.DecodeClaim(claim)
+	if err != nil {
+		return fmt.Errorf("%w: couldn't decode %s claim: %v", ErrMalformedClaim, name, err)
+	}
+
+	if !v.ValidClaimLen(len(sl.ClaimedSignature)) {
+		return ErrBadSignatureLength
+	}
+
+	return nil
+}
+
+// Parses the attributes following the claim, each written as ` <key>=<value>`.
+func parseAttributes(sl *Seal, attrs string) error {
+	if attrs == "" {
+		return nil
+	}
+	if attrs[0] != ' ' {
+		return fmt.Errorf("seal: invalid header attributes: %q", attrs)
+	}
+
+	seen := map[string]bool{}
+	meta := &Metadata{}
+	for _, attr := range strings.Split(attrs[1:], " ") {
+		i := strings.IndexByte(attr, '=')
+		if i <= 0 {
+			return fmt.Errorf("seal: invalid header attribute: %q", attr)
+		}
+		key, value := attr[:i], attr[i+1:]
+		if seen[key] {
+			return fmt.Errorf("seal: duplicate header attribute: %q", key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "chunk":
+			sl.ChunkSize, err = parseSize(value)
+			if err == nil && sl.ChunkSize == 0 {
+				err = errors.New("must not be zero")
+			}
+			if err == nil && sl.ChunkSize > MaxChunkSize {
+				return fmt.Errorf("%w: %d", ErrChunkTooLarge, sl.ChunkSize)
+			}
+		case "length":
+			sl.Length, err = parseSize(value)
+		case "parity":
+			var n int64
+			n, err = parseSize(value)
+			if err == nil && (n < 1 || n > ParityStripe) {
+				err = fmt.Errorf("must be between 1 and %d", ParityStripe)
+			}
+			sl.Parity = int(n)
+		default:
+			var ok bool
+			ok, err = meta.parseAttribute(key, value)
+			if !ok {
+				return fmt.Errorf("seal: unknown header attribute: %q", key)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("seal: invalid %s attribute: %v", key, err)
+		}
 	}
 
-	sig := header[IdentLen : len(header)-1]
+	if sl.ChunkSize > 0 && !seen["length"] {
+		return errors.New("seal: chunk attribute requires length")
+	}
+	if sl.Parity > 0 && sl.ChunkSize == 0 {
+		return errors.New("seal: parity attribute requires chunk")
+	}
+
+	if seen["name"] || seen["mode"] || seen["mtime"] {
+		if !(seen["name"] && seen["mode"] && seen["mtime"] && seen["length"]) {
+			return errors.New("seal: metadata requires name, mode, mtime and length")
+		}
+		sl.Metadata = meta
+	} else if seen["length"] && sl.ChunkSize == 0 {
+		return errors.New("seal: length attribute requires chunk or metadata")
+	}
+
+	return nil
+}
+
+// Checks that a chunk table is present for merkle variants, and only used
+// with variants that are hashes and claims in the header.
+func validateChunks(sl *Seal) error {
+	name := sl.VariantName()
+	if sl.ChunkSize == 0 {
+		if isTreeVariant(name) {
+			return errors.New("seal: merkle variants require the chunk attribute")
+		}
+		return nil
+	}
+
+	if sl.TrailerLen > 0 {
+		return errors.New("seal: chunk tables can't be used with a trailer")
+	}
+	_, err := tableAlgorithm(name)
+	if err != nil {
+		return fmt.Errorf("seal: %s seals can't have a chunk table", name)
+	}
+	return nil
+}
+
+// Metadata includes the length of the content, which isn't known when the
+// header of a seal with a trailer is written. It is covered by hashing it
+// after the content, which doesn't fit a merkle root.
+func validateMetadata(sl *Seal) error {
+	if sl.Metadata == nil {
+		return nil
+	}
+	if sl.TrailerLen > 0 {
+		return errors.New("seal: metadata can't be used with a trailer")
+	}
+	if isTreeVariant(sl.VariantName()) {
+		return errors.New("seal: merkle seals can't have metadata")
+	}
+	return nil
+}
 
-	if len(sig) <= 2 || (sig[0] != '{' && sig[len(sig)-1] != '}') {
-		return nil, fmt.Errorf("seal: invalid signature")
+func parseSize(value string) (int64, error) {
+	n, err := strconv.ParseUint(value, 10, 63)
+	return int64(n), err
+}
+
+// Returns the number of bytes in the trailer of a seal using the trailer
+// layout.
+func trailerLen(sl *Seal) int {
+	v, err := LookupVariant(sl.VariantName())
+	if err != nil {
+		panic(err)
 	}
-	sig = sig[1 : len(sig)-1]
+	return len(sl.line(v.EncodeClaim(make([]byte, sl.TrailerLen))))
+}
 
-	sl.ClaimedSignature, err = hex.DecodeString(string(sig))
+// Parses the trailer of a seal using the trailer layout, which repeats the
+// header with the claim filled in.
+func parseTrailer(sl *Seal, trailer []byte) error {
+	tsl, err := parseHeader(bufio.NewReader(bytes.NewReader(trailer)))
 	if err != nil {
-		return nil, fmt.Errorf("seal: couldn't decode signature: %v", err)
+		return &HeaderError{fmt.Errorf("seal: invalid trailer: %v", err)}
+	}
+
+	if tsl.Variant != sl.Variant || tsl.TrailerLen != 0 ||
+		len(tsl.ClaimedSignature) != sl.TrailerLen {
+		return &HeaderError{errors.New("seal: trailer does not match header")}
 	}
 
-	return sl, err
+	sl.ClaimedSignature = tsl.ClaimedSignature
+	return nil
 }
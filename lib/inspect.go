@@ -0,0 +1,70 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// HeaderInfo describes the header of a sealed file, as read by Inspect.
+type HeaderInfo struct {
+	// Header is the raw header line, without the line ending.
+	Header string
+
+	// Seal is the parsed header, or nil if the header is malformed, in
+	// which case Err says why.
+	Seal *Seal
+	Err  error
+
+	HeaderLen     int   // Bytes in the header, including the line ending.
+	ContentOffset int64 // Where the content starts.
+
+	// ClaimBits is the length of the claim, which is known from the header
+	// even when the claim is in a trailer.
+	ClaimBits int
+}
+
+// Returns true if the header could be parsed.
+func (hi *HeaderInfo) WellFormed() bool {
+	return hi.Err == nil
+}
+
+// Reads and describes the header of a sealed file without reading the
+// content. A malformed header is reported in the HeaderInfo as a *HeaderError;
+// an error is only returned if nothing could be read. `in` may be read past the header.
+func Inspect(in io.Reader) (*HeaderInfo, error) {
+	line, err := readHeaderLine(bufio.NewReader(in))
+	if len(line) == 0 {
+		if errors.Is(err, errNoHeader) {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	if err != nil && !errors.Is(err, ErrMalformedHeader) {
+		return nil, err
+	}
+
+	hi := &HeaderInfo{
+		Header:        string(bytes.TrimRight(line, "\r\n")),
+		HeaderLen:     len(line),
+		ContentOffset: int64(len(line)),
+		Err:           err, // The header never ended.
+	}
+	if hi.Err == nil {
+		hi.Seal, hi.Err = parseHeaderLine(line)
+	}
+	if hi.Err != nil {
+		hi.Seal = nil
+		return hi, nil
+	}
+
+	hi.ClaimBits = len(hi.Seal.ClaimedSignature) * 8
+	if hi.Seal.TrailerLen > 0 {
+		hi.ClaimBits = hi.Seal.TrailerLen * 8
+	}
+	return hi, nil
+}
@@ -0,0 +1,45 @@
+package seal
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect(t *testing.T) {
+	c := goodCases[1]
+	hi, err := Inspect(strings.NewReader(c.header + c.data))
+	require.Nil(t, err)
+	assert.True(t, hi.WellFormed())
+	assert.Equal(t, strings.TrimSuffix(c.header, "\n"), hi.Header)
+	assert.Equal(t, c.seal, hi.Seal)
+	assert.Equal(t, len(c.header), hi.HeaderLen)
+	assert.Equal(t, int64(len(c.header)), hi.ContentOffset)
+	assert.Equal(t, len(c.seal.ClaimedSignature)*8, hi.ClaimBits)
+
+	hi, err = Inspect(strings.NewReader("SL%v0{sha256:~32}\nseal!"))
+	require.Nil(t, err)
+	assert.Equal(t, 256, hi.ClaimBits)
+}
+
+func TestInspectMalformed(t *testing.T) {
+	for _, header := range []string{
+		"SL%v0{md5:cf83e135}\n",
+		"SL%v9{cf83e135}\n",
+		"SL%v0{cf83e135}",
+	} {
+		hi, err := Inspect(strings.NewReader(header))
+		require.Nil(t, err)
+		assert.False(t, hi.WellFormed(), header)
+		assert.True(t, errors.Is(hi.Err, ErrMalformedHeader), header)
+		assert.Nil(t, hi.Seal)
+		assert.Equal(t, strings.TrimSuffix(header, "\n"), hi.Header)
+	}
+
+	_, err := Inspect(strings.NewReader(""))
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+// Package manifest lists the files in a directory tree with a digest of each,
+// so that the whole tree can be checked with a single seal.
+//
+// A manifest is a text file. The first line names the format and the hash
+// algorithm, followed by a line per regular file sorted by path, and a last
+// line with the root digest, which is the hash of every line before it:
+//
+//	seal-manifest 1 sha512
+//	<hex digest> <size> <mtime> <path>
+//	...
+//	root <hex digest>
+//
+// Paths are relative to the root of the tree, use forward slashes, and have
+// each element escaped like a URL path. Modification times are RFC 3339 in
+// UTC.
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	seal "github.com/crasm/seal/lib"
+)
+
+const (
+	magic   = "seal-manifest"
+	version = 1
+)
+
+var ErrMalformed = errors.New("seal: malformed manifest")
+var ErrBadRoot = errors.New("seal: manifest root digest does not match")
+
+// Entry describes one file in a manifest.
+type Entry struct {
+	Path    string // Slash-separated and relative to the root.
+	Size    int64
+	ModTime time.Time
+	Digest  []byte
+}
+
+// Manifest lists the regular files in a directory tree.
+type Manifest struct {
+	Algorithm string
+	Entries   []Entry // Sorted by path.
+}
+
+// Hashes every regular file in fsys with the named algorithm. Symbolic links
+// and other special files are skipped.
+func Build(fsys fs.FS, algo string) (*Manifest, error) {
+	a, err := seal.LookupAlgorithm(algo)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Algorithm: algo}
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		digest, err := hashFile(fsys, path, a.New())
+		if err != nil {
+			return err
+		}
+
+		m.Entries = append(m.Entries, Entry{
+			Path:    path,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Digest:  digest,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// WalkDir visits in lexical order per directory, which isn't the same as
+	// sorting the whole paths.
+	sort.Slice(m.Entries, func(i, j int) bool {
+		return m.Entries[i].Path < m.Entries[j].Path
+	})
+	return m, nil
+}
+
+func hashFile(fsys fs.FS, path string, h hash.Hash) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Writes the manifest in its text form.
+func (m *Manifest) WriteTo(w io.Writer) (int64, error) {
+	a, err := seal.LookupAlgorithm(m.Algorithm)
+	if err != nil {
+		return 0, err
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s %d %s\n", magic, version, m.Algorithm)
+	for _, e := range m.Entries {
+		fmt.Fprintf(buf, "%x %d %s %s\n", e.Digest, e.Size,
+			e.ModTime.UTC().Format(time.RFC3339Nano), escapePath(e.Path))
+	}
+
+	root := a.New()
+	root.Write(buf.Bytes())
+	fmt.Fprintf(buf, "root %x\n", root.Sum(nil))
+
+	return buf.WriteTo(w)
+}
+
+// Parses a manifest from its text form, checking its root digest.
+func Parse(in io.Reader) (*Manifest, error) {
+	r := bufio.NewReader(in)
+	m := &Manifest{}
+	var root hash.Hash
+
+	for n := 1; ; n++ {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: no root digest", ErrMalformed)
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(line)
+
+		if n == 1 {
+			if len(fields) != 3 || fields[0] != magic || fields[1] != strconv.Itoa(version) {
+				return nil, fmt.Errorf("%w: not a version %d manifest", ErrMalformed, version)
+			}
+			a, err := seal.LookupAlgorithm(fields[2])
+			if err != nil {
+				return nil, err
+			}
+			m.Algorithm = a.Name
+			root = a.New()
+			root.Write([]byte(line))
+			continue
+		}
+
+		if len(fields) == 2 && fields[0] == "root" {
+			digest, err := hex.DecodeString(fields[1])
+			if err != nil || !bytes.Equal(digest, root.Sum(nil)) {
+				return nil, ErrBadRoot
+			}
+			return m, nil
+		}
+
+		e, err := parseEntry(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrMalformed, n, err)
+		}
+		if len(m.Entries) > 0 && m.Entries[len(m.Entries)-1].Path >= e.Path {
+			return nil, fmt.Errorf("%w: line %d: not sorted", ErrMalformed, n)
+		}
+		m.Entries = append(m.Entries, *e)
+		root.Write([]byte(line))
+	}
+}
+
+func parseEntry(fields []string) (*Entry, error) {
+	if len(fields) != 4 {
+		return nil, errors.New("wrong number of fields")
+	}
+
+	var e Entry
+	var err error
+	e.Digest, err = hex.DecodeString(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	e.Size, err = strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || e.Size < 0 {
+		return nil, fmt.Errorf("invalid size: %q", fields[1])
+	}
+	e.ModTime, err = time.Parse(time.RFC3339Nano, fields[2])
+	if err != nil {
+		return nil, err
+	}
+	e.Path, err = unescapePath(fields[3])
+	return &e, err
+}
+
+func escapePath(path string) string {
+	elems := strings.Split(path, "/")
+	for i, elem := range elems {
+		elems[i] = url.PathEscape(elem)
+	}
+	return strings.Join(elems, "/")
+}
+
+// Unescapes a path, which must stay within the root.
+func unescapePath(s string) (string, error) {
+	elems := strings.Split(s, "/")
+	for i, elem := range elems {
+		var err error
+		elems[i], err = url.PathUnescape(elem)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	path := strings.Join(elems, "/")
+	if !fs.ValidPath(path) || path == "." {
+		return "", fmt.Errorf("invalid path: %q", s)
+	}
+	return path, nil
+}
@@ -0,0 +1,102 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var mtime = time.Date(2016, 7, 4, 12, 30, 0, 0, time.UTC)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"a-c":           {Data: []byte("seal!"), ModTime: mtime},
+		"a/b":           {Data: []byte(""), ModTime: mtime},
+		"a/with space%": {Data: []byte("seal?"), ModTime: mtime},
+		"z":             {Data: []byte("zzz"), ModTime: mtime},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	m, err := Build(testFS(), "sha256")
+	require.Nil(t, err)
+
+	var paths []string
+	for _, e := range m.Entries {
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []string{"a-c", "a/b", "a/with space%", "z"}, paths)
+	assert.Equal(t, int64(5), m.Entries[0].Size)
+	assert.True(t, mtime.Equal(m.Entries[0].ModTime))
+
+	buf := &bytes.Buffer{}
+	_, err = m.WriteTo(buf)
+	require.Nil(t, err)
+	assert.True(t, strings.HasPrefix(buf.String(), "seal-manifest 1 sha256\n"))
+	assert.Contains(t, buf.String(), " a/with%20space%25\n")
+
+	parsed, err := Parse(buf)
+	require.Nil(t, err)
+	assert.Equal(t, m.Algorithm, parsed.Algorithm)
+	require.Len(t, parsed.Entries, len(m.Entries))
+	for i := range m.Entries {
+		assert.Equal(t, m.Entries[i].Path, parsed.Entries[i].Path)
+		assert.Equal(t, m.Entries[i].Digest, parsed.Entries[i].Digest)
+		assert.True(t, m.Entries[i].ModTime.Equal(parsed.Entries[i].ModTime))
+	}
+}
+
+func TestParseBad(t *testing.T) {
+	m, err := Build(testFS(), "sha256")
+	require.Nil(t, err)
+	buf := &bytes.Buffer{}
+	m.WriteTo(buf)
+	good := buf.String()
+
+	_, err = Parse(strings.NewReader(strings.Replace(good, " 5 ", " 6 ", 1)))
+	assert.Equal(t, ErrBadRoot, err)
+
+	for _, manifest := range []string{
+		"",
+		"seal-manifest 2 sha256\nroot 00\n",
+		strings.Replace(good, " a/b\n", " ../b\n", 1),
+		strings.Replace(good, " 5 ", " five ", 1),
+		good[:strings.Index(good, "root")],
+	} {
+		_, err = Parse(strings.NewReader(manifest))
+		assert.True(t, errors.Is(err, ErrMalformed), manifest)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	m, err := Build(testFS(), "sha256")
+	require.Nil(t, err)
+
+	fsys := testFS()
+	diffs, ok, err := m.Verify(fsys)
+	require.Nil(t, err)
+	assert.Empty(t, diffs)
+	assert.Equal(t, 4, ok)
+
+	delete(fsys, "a/b")
+	fsys["new"] = &fstest.MapFile{Data: []byte("new"), ModTime: mtime}
+	fsys["a-c"] = &fstest.MapFile{Data: []byte("seal?"), ModTime: mtime}
+	fsys["z"] = &fstest.MapFile{Data: []byte("zzzz"), ModTime: mtime.Add(time.Hour)}
+	fsys["a/with space%"].ModTime = mtime.Add(time.Hour) // Touched only.
+
+	diffs, ok, err = m.Verify(fsys)
+	require.Nil(t, err)
+	assert.Equal(t, []Difference{
+		{Path: "a-c", Status: Corrupt},
+		{Path: "a/b", Status: Missing},
+		{Path: "new", Status: Extra},
+		{Path: "z", Status: Modified},
+	}, diffs)
+	assert.Equal(t, 1, ok)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"sort"
+
+	seal "github.com/crasm/seal/lib"
+)
+
+// Status is how a file differs from its manifest entry.
+type Status int
+
+const (
+	OK       Status = iota
+	Missing         // Listed, but not in the tree.
+	Extra           // In the tree, but not listed.
+	Modified        // Changed since the manifest was made.
+	Corrupt         // Changed, but its size and mtime weren't.
+)
+
+func (s Status) String() string {
+	switch s {
+	case OK:
+		return "ok"
+	case Missing:
+		return "missing"
+	case Extra:
+		return "extra"
+	case Modified:
+		return "modified"
+	case Corrupt:
+		return "corrupt"
+	default:
+		return "unknown"
+	}
+}
+
+// Difference is a file that doesn't match the manifest, or couldn't be read.
+type Difference struct {
+	Path   string
+	Status Status
+	Err    error // Set if the file couldn't be read, and Status is OK.
+}
+
+// Checks the regular files in fsys against the manifest. Returns the files that
+// differ, sorted by path, along with the number of files that match.
+func (m *Manifest) Verify(fsys fs.FS) ([]Difference, int, error) {
+	a, err := seal.LookupAlgorithm(m.Algorithm)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	listed := make(map[string]bool, len(m.Entries))
+	for _, e := range m.Entries {
+		listed[e.Path] = true
+	}
+
+	var diffs []Difference
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() && !listed[path] {
+			diffs = append(diffs, Difference{Path: path, Status: Extra})
+		}
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ok := 0
+	for _, e := range m.Entries {
+		status, err := e.check(fsys, a)
+		if status == OK && err == nil {
+			ok++
+			continue
+		}
+		diffs = append(diffs, Difference{Path: e.Path, Status: status, Err: err})
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+	return diffs, ok, nil
+}
+
+// Checks a file against its entry. Bit rot changes the content of a file but
+// not its size or modification time, unlike a modification.
+func (e *Entry) check(fsys fs.FS, a *seal.Algorithm) (Status, error) {
+	info, err := fs.Stat(fsys, e.Path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && !info.Mode().IsRegular()) {
+		return Missing, nil
+	}
+	if err != nil {
+		return OK, err
+	}
+
+	unchanged := info.ModTime().Equal(e.ModTime)
+	if info.Size() != e.Size {
+		if unchanged {
+			return Corrupt, nil
+		}
+		return Modified, nil
+	}
+
+	digest, err := hashFile(fsys, e.Path, a.New())
+	if err != nil {
+		return OK, err
+	}
+	switch {
+	case bytes.Equal(digest, e.Digest):
+		return OK, nil
+	case unchanged:
+		return Corrupt, nil
+	default:
+		return Modified, nil
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata describes the file that was sealed. It is stored as header
+// attributes, along with the length of the content, and is covered by the
+// claim.
+type Metadata struct {
+	Name    string      // The base name of the file.
+	Mode    os.FileMode // Only the permission bits are kept.
+	ModTime time.Time
+}
+
+// Returns metadata for the file described by info.
+func FileMetadata(info os.FileInfo) *Metadata {
+	return &Metadata{
+		Name:    info.Name(),
+		Mode:    info.Mode().Perm(),
+		ModTime: info.ModTime(),
+	}
+}
+
+func (m *Metadata) attributes() string {
+	return fmt.Sprintf(" name=%s mode=%04o mtime=%s", url.PathEscape(m.Name),
+		uint32(m.Mode.Perm()), m.ModTime.UTC().Format(time.RFC3339Nano))
+}
+
+// Parses a metadata attribute into m. Returns false if key isn't one.
+func (m *Metadata) parseAttribute(key, value string) (bool, error) {
+	var err error
+	switch key {
+	case "name":
+		m.Name, err = url.PathUnescape(value)
+		if err == nil && !validName(m.Name) {
+			err = errors.New("must be a base name")
+		}
+	case "mode":
+		var n uint64
+		n, err = strconv.ParseUint(value, 8, 32)
+		if err == nil && n > uint64(os.ModePerm) {
+			err = errors.New("must only have permission bits")
+		}
+		m.Mode = os.FileMode(n)
+	case "mtime":
+		m.ModTime, err = time.Parse(time.RFC3339Nano, value)
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+// The longest name, which is the limit of most filesystems.
+const maxNameLen = 255
+
+// A name must not be able to escape the directory it is restored into.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && len(name) <= maxNameLen &&
+		!strings.ContainsAny(name, "/\\\x00")
+}
+
+// Returns the bytes that follow the content in the input to the claim, which
+// are the header attributes if the seal has metadata.
+func (sl *Seal) coveredAttributes() []byte {
+	if sl.Metadata == nil {
+		return nil
+	}
+	return []byte(sl.attributes())
+}
+
+// Same as WrapWith, but records meta and the length of the content in the
+// header.
+//
+// Deprecated: Use Wrap with WithAlgorithm, WithBits and WithMetadata.
+func WrapMetadata(in io.Reader, out io.WriteSeeker, algo string, bits int, meta *Metadata) (*Seal, error) {
+	return Wrap(in, out, WithAlgorithm(algo), WithBits(bits), WithMetadata(meta))
+}
@@ -0,0 +1,183 @@
+package seal
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMeta = &Metadata{
+	Name:    "seal me.txt",
+	Mode:    0755,
+	ModTime: time.Date(2016, 7, 4, 12, 30, 0, 500, time.UTC),
+}
+
+// Seals "seal!" with testMeta, returning the sealed bytes.
+func wrapMetadata(t *testing.T) (*Seal, []byte) {
+	f, err := ioutil.TempFile("", "seal")
+	require.Nil(t, err)
+	os.Remove(f.Name())
+	defer f.Close()
+
+	sl, err := WrapMetadata(strings.NewReader("seal!"), f, VariantSHA256, 128, testMeta)
+	require.Nil(t, err)
+
+	_, err = f.Seek(0, 0)
+	require.Nil(t, err)
+	sealed, err := ioutil.ReadAll(f)
+	require.Nil(t, err)
+	return sl, sealed
+}
+
+func TestWrapMetadata(t *testing.T) {
+	sl, sealed := wrapMetadata(t)
+	assert.Equal(t, int64(5), sl.Length)
+	assert.True(t, strings.HasSuffix(sl.String(),
+		"} length=0000000000000000005 name=seal%20me.txt mode=0755 mtime=2016-07-04T12:30:00.0000005Z\n"))
+
+	unwrapped := &bytes.Buffer{}
+	usl, err := Unwrap(bytes.NewReader(sealed), unwrapped)
+	require.Nil(t, err)
+	assert.Equal(t, sl, &usl.Seal)
+	assert.Equal(t, testMeta, usl.Metadata)
+	assert.Equal(t, "seal!", unwrapped.String())
+
+	hsl, err := ReadHeader(bytes.NewReader(sealed))
+	require.Nil(t, err)
+	assert.Equal(t, sl, hsl)
+}
+
+func TestUnwrapMetadataBad(t *testing.T) {
+	_, sealed := wrapMetadata(t)
+
+	cases := []struct {
+		sealed string
+		err    error
+	}{
+		// The claim covers the metadata.
+		{strings.Replace(string(sealed), "mode=0755", "mode=0777", 1), ErrSealBroken},
+		{string(sealed[:len(sealed)-1]), io.ErrUnexpectedEOF},
+		{string(sealed) + "!", ErrTrailingData},
+	}
+
+	for _, c := range cases {
+		_, err := Unwrap(strings.NewReader(c.sealed), ioutil.Discard)
+		assert.Equal(t, c.err, err)
+	}
+}
+
+func TestParseHeaderMetadataBad(t *testing.T) {
+	claim := strings.Repeat("00", 16)
+	meta := " length=5 name=a mode=0644 mtime=2016-07-04T12:30:00Z"
+	for _, header := range []string{
+		"SL%v0{sha256:" + claim + "} length=5",
+		"SL%v0{sha256:" + claim + "} name=a mode=0644 mtime=2016-07-04T12:30:00Z",
+		"SL%v0{sha256:" + claim + "} length=5 name=a mode=0644",
+		"SL%v0{sha256:" + claim + "} length=5 name=..%2Fa mode=0644 mtime=2016-07-04T12:30:00Z",
+		"SL%v0{sha256:" + claim + "} length=5 name=a mode=4755 mtime=2016-07-04T12:30:00Z",
+		"SL%v0{sha256:" + claim + "} length=5 name=a mode=0644 mtime=yesterday",
+		"SL%v0{sha256:~16}" + meta,
+		"SL%v0{merkle-sha256:" + strings.Repeat("00", 32) + "} chunk=4" + meta,
+	} {
+		_, err := parseHeader(bufio.NewReader(strings.NewReader(header + "\n")))
+		assert.NotNil(t, err, header)
+	}
+
+	_, err := parseHeader(bufio.NewReader(strings.NewReader("SL%v0{sha256:" + claim + "}" + meta + "\n")))
+	assert.Nil(t, err)
+}
+
+// Metadata is carried through seals with a chunk table and parity, and is
+// covered by the claim as it is without them.
+func TestWrapMetadataChunked(t *testing.T) {
+	content := strings.Repeat("seal!", 100)
+	for _, opts := range [][]Option{
+		{WithAlgorithm(VariantSHA256), WithChunk(16)},
+		{WithAlgorithm(VariantSHA256), WithChunk(16), WithParity(10)},
+	} {
+		f, err := ioutil.TempFile("", "seal")
+		require.Nil(t, err)
+		os.Remove(f.Name())
+		defer f.Close()
+
+		sl, err := Wrap(strings.NewReader(content), f, append(opts, WithMetadata(testMeta))...)
+		require.Nil(t, err)
+		assert.Equal(t, testMeta, sl.Metadata)
+		assert.Contains(t, sl.String(), " length=0000000000000000500")
+		assert.True(t, strings.HasSuffix(sl.String(), " name=seal%20me.txt mode=0755 mtime=2016-07-04T12:30:00.0000005Z\n"))
+
+		_, err = f.Seek(0, 0)
+		require.Nil(t, err)
+		sealed, err := ioutil.ReadAll(f)
+		require.Nil(t, err)
+
+		unwrapped := &bytes.Buffer{}
+		usl, err := Unwrap(bytes.NewReader(sealed), unwrapped)
+		require.Nil(t, err)
+		assert.Equal(t, testMeta, usl.Metadata)
+		assert.Equal(t, content, unwrapped.String())
+
+		ra, err := NewReaderAt(bytes.NewReader(sealed), int64(len(sealed)))
+		require.Nil(t, err)
+		assert.Nil(t, ra.Check())
+
+		broken := []byte(strings.Replace(string(sealed), "mode=0755", "mode=0777", 1))
+		_, err = Unwrap(bytes.NewReader(broken), ioutil.Discard)
+		assert.Equal(t, ErrSealBroken, err)
+		ra, err = NewReaderAt(bytes.NewReader(broken), int64(len(broken)))
+		require.Nil(t, err)
+		assert.Equal(t, ErrSealBroken, ra.Check())
+
+		if sl.Parity > 0 {
+			out := &bytes.Buffer{}
+			_, err = Repair(bytes.NewReader(sealed), out)
+			require.Nil(t, err)
+			assert.Equal(t, sealed, out.Bytes())
+		}
+	}
+
+	// A merkle root can't cover metadata.
+	_, err := Wrap(strings.NewReader(content), &bytes.Buffer{},
+		WithAlgorithm(treePrefix+VariantSHA256), WithMetadata(testMeta))
+	assert.NotNil(t, err)
+}
+
+// The length in the header is checked against the size of the input before
+// any content is written.
+func TestUnwrapMetadataTruncated(t *testing.T) {
+	_, sealed := wrapMetadata(t)
+	chunked := &bytes.Buffer{}
+	_, err := Wrap(strings.NewReader(strings.Repeat("seal!", 100)), chunked,
+		WithAlgorithm(VariantSHA256), WithChunk(16), WithMetadata(testMeta))
+	require.Nil(t, err)
+
+	for _, truncated := range [][]byte{
+		sealed[:len(sealed)-1],
+		// Only the chunk table is short.
+		chunked.Bytes()[:chunked.Len()-1],
+	} {
+		out := &bytes.Buffer{}
+		_, err := Unwrap(bytes.NewReader(truncated), out)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		assert.Zero(t, out.Len())
+
+		r, err := NewReader(bytes.NewReader(truncated))
+		require.Nil(t, err)
+		n, err := r.Read(make([]byte, 10))
+		assert.Zero(t, n)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+		// When the size of the input isn't known, the truncation is
+		// only found at its end.
+		_, err = Unwrap(struct{ io.Reader }{bytes.NewReader(truncated)}, ioutil.Discard)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	}
+}
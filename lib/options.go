@@ -0,0 +1,141 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import "context"
+
+// The size of the buffers content is copied through, unless WithBufferSize
+// says otherwise. They're large so that the goroutines of a pipeline hand off
+// rarely.
+const defaultBufferSize = 1 << 20
+
+// Option configures Wrap. WithProgress also applies to the other
+// context-aware functions.
+type Option func(*wrapConfig)
+
+type wrapConfig struct {
+	algo    string
+	bits    int
+	hasBits bool // Otherwise the claim is the algorithm's full digest.
+	meta    *Metadata
+	signer  *SecretKey
+	bufSize int
+
+	chunk     int64
+	hasChunk  bool
+	parity    int
+	hasParity bool
+
+	ctx      context.Context
+	progress func(done, total int64)
+}
+
+func newWrapConfig(opts []Option) *wrapConfig {
+	c := &wrapConfig{algo: DefaultVariant, bufSize: defaultBufferSize}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Truncates the claim to bits, which must be a whole number of bytes no
+// longer than the algorithm's digest. By default the claim is the full digest.
+func WithBits(bits int) Option {
+	return func(c *wrapConfig) {
+		c.bits, c.hasBits = bits, true
+	}
+}
+
+// Hashes with the named algorithm instead of DefaultVariant. A merkle
+// variant, like merkle-sha256, may be named as well; its claim is always the
+// full root, and it has a chunk table whether or not WithChunk is given.
+func WithAlgorithm(algo string) Option {
+	return func(c *wrapConfig) {
+		c.algo = algo
+	}
+}
+
+// Records meta and the length of the content in the header. Both are covered
+// by the claim.
+func WithMetadata(meta *Metadata) Option {
+	return func(c *wrapConfig) {
+		c.meta = meta
+	}
+}
+
+// Signs the content with key instead of hashing it, making a signify seal.
+// The algorithm and bits don't apply, and the content is held in memory.
+func WithSigner(key *SecretKey) Option {
+	return func(c *wrapConfig) {
+		c.signer = key
+	}
+}
+
+// Stores a table of the hashes of size byte chunks after the content, which
+// locates corruption and allows random access with ReaderAt. The size must be
+// between 1 and MaxChunkSize. If `out` can't seek, the seal is buffered in a
+// temporary file.
+func WithChunk(size int64) Option {
+	return func(c *wrapConfig) {
+		c.chunk, c.hasChunk = size, true
+	}
+}
+
+// Stores Reed-Solomon parity of percent of the content, from 1 to
+// ParityStripe, after the chunk table, which Repair uses to rebuild corrupt
+// chunks. Chunks are DefaultChunkSize bytes unless WithChunk is given. The
+// parity is calculated by reading back the content written to `out`, so if
+// `out` isn't an io.ReadWriteSeeker, the seal is buffered in a temporary file.
+func WithParity(percent int) Option {
+	return func(c *wrapConfig) {
+		c.parity, c.hasParity = percent, true
+	}
+}
+
+// Reports whether the seal will have a chunk table.
+func (c *wrapConfig) chunked() bool {
+	return c.hasChunk || c.hasParity || isTreeVariant(c.algo)
+}
+
+// Copies content through buffers of size bytes. Sizes of 0 or less use the
+// default of 1 MiB.
+func WithBufferSize(size int) Option {
+	return func(c *wrapConfig) {
+		if size <= 0 {
+			size = defaultBufferSize
+		}
+		c.bufSize = size
+	}
+}
+
+// Stops reading the content once ctx is done, returning ctx.Err().
+// Cancellation is noticed between reads, so a read that blocks isn't
+// interrupted.
+func WithContext(ctx context.Context) Option {
+	return func(c *wrapConfig) {
+		c.ctx = ctx
+	}
+}
+
+// Calls progress after each read of the content with the number of bytes read
+// so far, and the size of the input or -1 if it isn't known. It's called on
+// the reading goroutine, so it should return quickly.
+func WithProgress(progress func(done, total int64)) Option {
+	return func(c *wrapConfig) {
+		c.progress = progress
+	}
+}
+
+// Returns the length of the claim in bytes for algorithm a, or
+// ErrBadSignatureLength if the bits are invalid.
+func (c *wrapConfig) sigLen(a *Algorithm) (int, error) {
+	if !c.hasBits {
+		return a.MaxBytes, nil
+	}
+	n := bitsToBytes(c.bits, a.MaxBytes)
+	if n == -1 {
+		return 0, ErrBadSignatureLength
+	}
+	return n, nil
+}
@@ -0,0 +1,148 @@
+package seal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapOptions(t *testing.T) {
+	sha256Claim := "da13cda74a35640298d70bf3286a020e26e4b526f63bf8f9b05fc5a490900d4a"
+	cases := []struct {
+		opts   []Option
+		header string // Of a file, which can seek.
+	}{
+		{nil, goodCases[1].header},
+		{[]Option{WithBits(8)}, "SL%v0{0d}\n"},
+		{[]Option{WithAlgorithm(VariantSHA256), WithBufferSize(1)}, "SL%v0{sha256:" + sha256Claim + "}\n"},
+		{[]Option{WithAlgorithm(VariantSHA256), WithBits(16)}, "SL%v0{sha256:" + sha256Claim[:4] + "}\n"},
+		{[]Option{WithMetadata(vectorMetadata), WithBits(8)},
+			"SL%v0{c4} length=0000000000000000006 name=seal.txt mode=0644 mtime=2016-07-04T12:30:00Z\n"},
+	}
+
+	for _, c := range cases {
+		f, err := ioutil.TempFile("", "seal-options-")
+		require.Nil(t, err)
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		_, err = Wrap(strings.NewReader("seal!\n"), f, c.opts...)
+		require.Nil(t, err)
+		data, err := ioutil.ReadFile(f.Name())
+		require.Nil(t, err)
+		assert.Equal(t, c.header+"seal!\n", string(data))
+
+		// Writers that can't seek get the trailer layout, unless there's
+		// metadata, which must be in the header.
+		buf := &bytes.Buffer{}
+		sl, err := Wrap(strings.NewReader("seal!\n"), buf, c.opts...)
+		require.Nil(t, err)
+		if sl.Metadata != nil {
+			assert.Equal(t, string(data), buf.String())
+		} else {
+			assert.NotEqual(t, 0, sl.TrailerLen)
+			usl, err := Unwrap(buf, ioutil.Discard)
+			require.Nil(t, err)
+			assert.Equal(t, c.header, usl.claimLine())
+		}
+	}
+}
+
+// The options make the same seals as the functions they replace did when
+// the test vectors were made, whether or not the output can seek.
+func TestWrapOptionsVectors(t *testing.T) {
+	cases := []struct {
+		vector string
+		opts   []Option
+	}{
+		{"sha512-truncated", []Option{WithBits(256)}},
+		{"blake3-8bit", []Option{WithAlgorithm(VariantBLAKE3), WithBits(8)}},
+		{"metadata-sha256", []Option{WithAlgorithm(VariantSHA256), WithBits(256), WithMetadata(vectorMetadata)}},
+		{"signify", []Option{WithSigner(testSecretKey())}},
+		{"merkle-sha256", []Option{WithAlgorithm(treePrefix + VariantSHA256), WithChunk(4)}},
+		{"table-sha256", []Option{WithAlgorithm(VariantSHA256), WithBits(256), WithChunk(4)}},
+		{"parity-sha256", []Option{WithAlgorithm(VariantSHA256), WithBits(256), WithChunk(4), WithParity(10)}},
+	}
+
+	vectors := readVectors(t, "good")
+	for _, c := range cases {
+		expected := string(vectors[c.vector])
+		require.NotEmpty(t, expected, c.vector)
+		data := sealVector(t, func(in io.Reader, out *os.File) error {
+			_, err := Wrap(in, out, c.opts...)
+			return err
+		})
+		assert.Equal(t, expected, string(data), c.vector)
+
+		// Only plain hashes are streamed with the trailer layout when the
+		// output can't seek. The rest are buffered, and come out the same.
+		buf := &bytes.Buffer{}
+		sl, err := Wrap(strings.NewReader(vectorContent), buf, c.opts...)
+		require.Nil(t, err, c.vector)
+		if sl.TrailerLen == 0 {
+			assert.Equal(t, expected, buf.String(), c.vector)
+		} else {
+			assert.Nil(t, sl.Metadata, c.vector)
+			assert.Zero(t, sl.ChunkSize, c.vector)
+		}
+	}
+
+	data := strings.Repeat(treeData, 20)
+	// Merkle variants have a chunk table of the default size.
+	sl, err := Wrap(strings.NewReader(data), &bytes.Buffer{}, WithAlgorithm(treePrefix+VariantSHA256))
+	require.Nil(t, err)
+	assert.Equal(t, int64(DefaultChunkSize), sl.ChunkSize)
+	sl, err = Wrap(strings.NewReader(data), &bytes.Buffer{}, WithParity(10))
+	require.Nil(t, err)
+	assert.Equal(t, int64(DefaultChunkSize), sl.ChunkSize)
+	assert.Equal(t, 10, sl.Parity)
+}
+
+func TestWrapOptionsSigner(t *testing.T) {
+	buf := &bytes.Buffer{}
+	_, err := Wrap(strings.NewReader("seal!\n"), buf, WithSigner(testSecretKey()))
+	require.Nil(t, err)
+	assert.True(t, strings.HasPrefix(buf.String(), "SL%v0{signify:"))
+
+	out := &bytes.Buffer{}
+	_, err = UnwrapSignify(buf, out, testSecretKey().Public())
+	require.Nil(t, err)
+	assert.Equal(t, "seal!\n", out.String())
+
+	_, err = Wrap(strings.NewReader("seal!\n"), &bytes.Buffer{},
+		WithSigner(testSecretKey()), WithMetadata(vectorMetadata))
+	assert.NotNil(t, err)
+}
+
+func TestWrapOptionsBad(t *testing.T) {
+	for _, c := range badCases {
+		_, err := Wrap(strings.NewReader(c.data), &bytes.Buffer{}, WithBits(c.bits))
+		assert.Equal(t, ErrBadSignatureLength, err)
+	}
+
+	_, err := Wrap(strings.NewReader("seal!\n"), &bytes.Buffer{}, WithAlgorithm("md5"))
+	assert.True(t, errors.Is(err, ErrUnknownAlgorithm))
+
+	_, err = Wrap(strings.NewReader("seal!\n"), &bytes.Buffer{},
+		WithMetadata(&Metadata{Name: "../seal.txt"}))
+	assert.NotNil(t, err)
+
+	for _, chunk := range []int64{0, -1, MaxChunkSize + 1} {
+		_, err = Wrap(strings.NewReader("seal!\n"), &bytes.Buffer{}, WithChunk(chunk))
+		assert.Equal(t, ErrBadChunkSize, err)
+	}
+	for _, parity := range []int{0, -1, ParityStripe + 1} {
+		_, err = Wrap(strings.NewReader("seal!\n"), &bytes.Buffer{}, WithParity(parity))
+		assert.Equal(t, ErrBadParity, err)
+	}
+	_, err = Wrap(strings.NewReader("seal!\n"), &bytes.Buffer{},
+		WithSigner(testSecretKey()), WithChunk(4))
+	assert.NotNil(t, err)
+}
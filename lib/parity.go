@@ -0,0 +1,503 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"io"
+	"math"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+// Parity chunks are Reed-Solomon codes over stripes of this many chunks, so
+// the parity attribute is also the percentage of redundancy. A short last
+// stripe is split into this many shards of equal size instead, padded with
+// zero bytes, so that its parity stays in proportion to it.
+//
+// The parity chunks follow the chunk table, stripe by stripe, and are
+// followed by a table of their hashes, so that corrupt parity is never used
+// for a repair. If the last stripe is short, a table of the hashes of its
+// shards comes last, so that only the shards that are corrupt are rebuilt,
+// rather than every shard of a corrupt chunk.
+const ParityStripe = 100
+
+var ErrBadParity = errors.New("seal: parity must be between 1 and 100 percent")
+var ErrNoParity = errors.New("seal: seal has no parity")
+var ErrUnrepairable = errors.New("seal: too much corruption to repair")
+
+// Returns the number of stripes of a seal.
+func stripeCount(sl *Seal) int64 {
+	chunks := (sl.Length + sl.ChunkSize - 1) / sl.ChunkSize
+	return (chunks + ParityStripe - 1) / ParityStripe
+}
+
+// Returns the offset of stripe s in the content, and its length.
+func stripeBounds(sl *Seal, s int64) (off, n int64) {
+	off = s * ParityStripe * sl.ChunkSize
+	n = ParityStripe * sl.ChunkSize
+	if n > sl.Length-off {
+		n = sl.Length - off
+	}
+	return off, n
+}
+
+// Returns the size of the shards of stripe s, which is the chunk size unless
+// it's a short last stripe.
+func shardSize(sl *Seal, s int64) int64 {
+	_, n := stripeBounds(sl, s)
+	return (n + ParityStripe - 1) / ParityStripe
+}
+
+// Returns the number of parity chunks of a seal.
+func parityChunks(sl *Seal) int64 {
+	if sl.Parity == 0 {
+		return 0
+	}
+	return stripeCount(sl) * int64(sl.Parity)
+}
+
+// Reports whether stripe s is the last one, and holds less than
+// ParityStripe full chunks.
+func shortStripe(sl *Seal, s int64) bool {
+	_, n := stripeBounds(sl, s)
+	return s == stripeCount(sl)-1 && n < ParityStripe*sl.ChunkSize
+}
+
+// Returns the size of the parity chunks of a seal alone.
+func parityLen(sl *Seal) int64 {
+	stripes := stripeCount(sl)
+	if sl.Parity == 0 || stripes == 0 {
+		return 0
+	}
+	return int64(sl.Parity) * ((stripes-1)*sl.ChunkSize + shardSize(sl, stripes-1))
+}
+
+// Returns the size of the table of the shards of a short last stripe.
+func shardTableLen(sl *Seal, algo *Algorithm) int64 {
+	stripes := stripeCount(sl)
+	if sl.Parity == 0 || stripes == 0 || !shortStripe(sl, stripes-1) {
+		return 0
+	}
+	return ParityStripe * int64(algo.MaxBytes)
+}
+
+// Returns the size of the parity chunks of a seal and their tables.
+func paritySize(sl *Seal, algo *Algorithm) int64 {
+	return parityLen(sl) + parityChunks(sl)*int64(algo.MaxBytes) + shardTableLen(sl, algo)
+}
+
+// Same as WrapChunked, but also stores parity percent of the size of the
+// content, which Repair uses to rebuild corrupt chunks. variant may be a
+// merkle variant, in which case bits is ignored.
+//
+// Parity is calculated in a second pass over the content written to out.
+//
+// Deprecated: Use Wrap with WithAlgorithm, WithBits, WithChunk and
+// WithParity.
+func WrapParity(in io.Reader, out io.ReadWriteSeeker, variant string, bits int, chunkSize int64, parity int) (*Seal, error) {
+	return Wrap(in, out, WithAlgorithm(variant), WithBits(bits), WithChunk(chunkSize), WithParity(parity))
+}
+
+// Reads back the content of a seal that has been written up to the end of
+// its chunk table, then appends the parity chunks and their table.
+func writeParity(rw io.ReadWriteSeeker, sl *Seal, algo *Algorithm) error {
+	enc, err := reedsolomon.New(ParityStripe, sl.Parity)
+	if err != nil {
+		return err
+	}
+
+	offset := int64(len(sl.String()))
+	_, tableLen := chunkTable(sl, algo)
+	end := offset + sl.Length + tableLen
+
+	buf := make([]byte, shardSize(sl, 0))
+	parity := makeShards(sl.Parity, shardSize(sl, 0))
+	var table, shardTable [][]byte
+
+	for s := int64(0); s < stripeCount(sl); s++ {
+		start, n := stripeBounds(sl, s)
+		size := shardSize(sl, s)
+		for i := range parity {
+			parity[i] = parity[i][:size]
+			zero(parity[i])
+		}
+
+		_, err = rw.Seek(offset+start, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		for k := int64(0); k*size < n; k++ {
+			m := size
+			if m > n-k*size {
+				m = n - k*size
+			}
+			_, err = io.ReadFull(rw, buf[:m])
+			if err != nil {
+				return err
+			}
+			zero(buf[m:size])
+
+			err = enc.EncodeIdx(buf[:size], int(k), parity)
+			if err != nil {
+				return err
+			}
+			if shortStripe(sl, s) {
+				shardTable = append(shardTable, leafHash(algo, buf[:size]))
+			}
+		}
+
+		_, err = rw.Seek(end, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		for _, p := range parity {
+			_, err = rw.Write(p)
+			if err != nil {
+				return err
+			}
+			table = append(table, leafHash(algo, p))
+		}
+		end += int64(len(parity)) * size
+	}
+
+	// The shards that are only padding are hashed as well.
+	if len(shardTable) > 0 {
+		pad := leafHash(algo, make([]byte, shardSize(sl, stripeCount(sl)-1)))
+		for len(shardTable) < ParityStripe {
+			shardTable = append(shardTable, pad)
+		}
+	}
+	err = writeTable(rw, table)
+	if err != nil {
+		return err
+	}
+	return writeTable(rw, shardTable)
+}
+
+// Repairs the seal in `in`, writing the repaired seal to out. Chunks that
+// don't match the chunk table are rebuilt from parity, and the repaired
+// content is verified against the claim. The chunk table and parity are
+// written anew, so corruption in them is repaired as well.
+//
+// A stripe of chunks is held in memory at a time. Returns the ranges of
+// content that were rebuilt; if an error is returned, out holds a partial
+// seal.
+func Repair(in io.ReaderAt, out io.Writer) ([]Range, error) {
+	header, sl, err := readHeaderAt(in, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	if sl.ChunkSize == 0 {
+		return nil, ErrNotChunked
+	}
+	if sl.Parity == 0 {
+		return nil, ErrNoParity
+	}
+
+	algo, err := tableAlgorithm(sl.VariantName())
+	if err != nil {
+		return nil, err
+	}
+
+	// The content and chunk table must be there, which bounds the memory
+	// used for them by the size of `in`, whatever the header says.
+	_, tableLen := chunkTable(sl, algo)
+	last := int64(len(header)) + sl.Length + tableLen - 1
+	if sl.Length > 0 && !readAtPadded(in, make([]byte, 1), last) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	rp, err := newRepairer(in, sl, algo, int64(len(header)))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = out.Write(header)
+	if err != nil {
+		return nil, err
+	}
+
+	th := newTreeHash(algo, sl.ChunkSize)
+	var h hash.Hash = th
+	content := io.MultiWriter(out, th)
+	if !isTreeVariant(sl.VariantName()) {
+		h = algo.New()
+		content = io.MultiWriter(out, th, h)
+	}
+
+	var repaired []Range
+	for s := int64(0); s < rp.stripes; s++ {
+		changed, err := rp.rebuild(s, false)
+		if err != nil {
+			return repaired, err
+		}
+		for _, i := range changed {
+			repaired = addRange(repaired, i*sl.ChunkSize, chunkLen(sl, i))
+		}
+
+		_, n := stripeBounds(sl, s)
+		_, err = content.Write(rp.data[:n])
+		if err != nil {
+			return repaired, err
+		}
+	}
+
+	if h != hash.Hash(th) {
+		h.Write(sl.coveredAttributes())
+	}
+	_, err = hashVerifier{h}.verify(sl.ClaimedSignature)
+	if err != nil {
+		return repaired, err
+	}
+
+	err = writeTable(out, th.Leaves())
+	if err != nil {
+		return repaired, err
+	}
+
+	// The parity is rebuilt in a second pass, since it follows the content.
+	var table, shardTable [][]byte
+	for s := int64(0); s < rp.stripes; s++ {
+		_, err := rp.rebuild(s, true)
+		if err != nil {
+			return repaired, err
+		}
+
+		for _, p := range rp.shards[ParityStripe:] {
+			_, err = out.Write(p)
+			if err != nil {
+				return repaired, err
+			}
+			table = append(table, leafHash(algo, p))
+		}
+		if shortStripe(sl, s) {
+			for _, p := range rp.shards[:ParityStripe] {
+				shardTable = append(shardTable, leafHash(algo, p))
+			}
+		}
+	}
+
+	err = writeTable(out, table)
+	if err != nil {
+		return repaired, err
+	}
+	return repaired, writeTable(out, shardTable)
+}
+
+// repairer rebuilds the stripes of a seal from its parity.
+type repairer struct {
+	sl      *Seal
+	in      io.ReaderAt
+	algo    *Algorithm
+	enc     reedsolomon.Encoder
+	offset  int64 // Start of the content.
+	stripes int64
+
+	table, parityTable [][]byte
+	shardTable         [][]byte // Of the last stripe, if it's short.
+
+	data   []byte   // The content of the stripe being rebuilt.
+	parity [][]byte // Its parity chunks.
+	shards [][]byte // The shards of data, then parity.
+}
+
+func newRepairer(in io.ReaderAt, sl *Seal, algo *Algorithm, offset int64) (*repairer, error) {
+	enc, err := reedsolomon.New(ParityStripe, sl.Parity)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first stripe has the largest shards, and is no larger than the
+	// content.
+	size := shardSize(sl, 0)
+	rp := &repairer{
+		sl:      sl,
+		in:      in,
+		algo:    algo,
+		enc:     enc,
+		offset:  offset,
+		stripes: stripeCount(sl),
+		data:    make([]byte, ParityStripe*size),
+		parity:  makeShards(sl.Parity, size),
+		shards:  make([][]byte, ParityStripe+sl.Parity),
+	}
+
+	// Missing or corrupt table entries make their chunks look corrupt, and
+	// rebuilding an intact chunk is harmless.
+	_, tableLen := chunkTable(sl, algo)
+	table := make([]byte, tableLen)
+	readAtPadded(in, table, offset+sl.Length)
+	rp.table = splitTable(table, algo.MaxBytes)
+
+	off := offset + sl.Length + tableLen + parityLen(sl)
+	table = make([]byte, parityChunks(sl)*int64(algo.MaxBytes))
+	readAtPadded(in, table, off)
+	rp.parityTable = splitTable(table, algo.MaxBytes)
+
+	off += int64(len(table))
+	table = make([]byte, shardTableLen(sl, algo))
+	readAtPadded(in, table, off)
+	rp.shardTable = splitTable(table, algo.MaxBytes)
+
+	return rp, nil
+}
+
+// Reads stripe s into rp.data and rp.shards, rebuilding the data chunks that
+// are corrupt, and the parity chunks as well if withParity is set. Returns
+// the chunks whose content changed.
+func (rp *repairer) rebuild(s int64, withParity bool) ([]int64, error) {
+	sl, shards := rp.sl, rp.shards
+	start, n := stripeBounds(sl, s)
+	size := shardSize(sl, s)
+
+	data := rp.data[:ParityStripe*size]
+	readAtPadded(rp.in, data[:n], rp.offset+start)
+	zero(data[n:])
+	for k := range shards[:ParityStripe] {
+		end := int64(k+1) * size
+		shards[k] = data[end-size : end : end]
+	}
+
+	// Every shard of a full stripe is a chunk. A shard of a short stripe is
+	// missing if it doesn't match the shard table, and neither does a chunk
+	// it overlaps, so that corruption in only one of the tables loses
+	// nothing. What was read of missing shards is kept, to tell whether only
+	// their table entries were corrupt.
+	short := shortStripe(sl, s)
+	var missing []int64
+	var origs [][]byte
+	for k := range shards[:ParityStripe] {
+		if short && (bytes.Equal(leafHash(rp.algo, shards[k]), rp.shardTable[k]) ||
+			rp.chunksIntact(start, start+int64(k)*size, size)) {
+			continue
+		}
+		if !short && bytes.Equal(leafHash(rp.algo, shards[k]), rp.table[s*ParityStripe+int64(k)]) {
+			continue
+		}
+
+		missing = append(missing, int64(k))
+		origs = append(origs, append([]byte(nil), shards[k]...))
+		shards[k] = shards[k][:0]
+	}
+
+	_, tableLen := chunkTable(sl, rp.algo)
+	parityOff := rp.offset + sl.Length + tableLen + s*int64(sl.Parity)*sl.ChunkSize
+	badParity := false
+	for k := range shards[ParityStripe:] {
+		j := s*int64(sl.Parity) + int64(k)
+		p := rp.parity[k][:size]
+		shards[ParityStripe+k] = p
+
+		ok := readAtPadded(rp.in, p, parityOff+int64(k)*size)
+		if !ok || !bytes.Equal(leafHash(rp.algo, p), rp.parityTable[j]) {
+			shards[ParityStripe+k] = p[:0]
+			badParity = true
+		}
+	}
+
+	if len(missing) == 0 && !(withParity && badParity) {
+		return nil, nil
+	}
+
+	var err error
+	if withParity {
+		err = rp.enc.Reconstruct(shards)
+	} else {
+		err = rp.enc.ReconstructData(shards)
+	}
+	if err == reedsolomon.ErrTooFewShards {
+		return nil, ErrUnrepairable
+	} else if err != nil {
+		return nil, err
+	}
+
+	// A chunk changed if any of the shards it overlaps did.
+	var changed []int64
+	for m, k := range missing {
+		lo, hi := k*size, (k+1)*size
+		if hi > n {
+			hi = n
+		}
+		if lo >= hi {
+			continue // Only padding.
+		}
+		for i := (start + lo) / sl.ChunkSize; i*sl.ChunkSize < start+hi; i++ {
+			a, b := i*sl.ChunkSize-start, i*sl.ChunkSize-start+chunkLen(sl, i)
+			if a < lo {
+				a = lo
+			}
+			if b > hi {
+				b = hi
+			}
+			if bytes.Equal(origs[m][a-lo:b-lo], data[a:b]) {
+				continue
+			}
+			if len(changed) == 0 || changed[len(changed)-1] != i {
+				changed = append(changed, i)
+			}
+		}
+	}
+	return changed, nil
+}
+
+// Reports whether the chunks overlapping the n bytes of content at off match
+// the chunk table, given that rp.data holds the stripe starting at start.
+func (rp *repairer) chunksIntact(start, off, n int64) bool {
+	sl := rp.sl
+	end := off + n
+	if end > sl.Length {
+		end = sl.Length
+	}
+	for i := off / sl.ChunkSize; i*sl.ChunkSize < end; i++ {
+		a := i*sl.ChunkSize - start
+		if !bytes.Equal(leafHash(rp.algo, rp.data[a:a+chunkLen(sl, i)]), rp.table[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the length of chunk i, which is only short for the last chunk.
+func chunkLen(sl *Seal, i int64) int64 {
+	n := sl.ChunkSize
+	if n > sl.Length-i*sl.ChunkSize {
+		n = sl.Length - i*sl.ChunkSize
+	}
+	return n
+}
+
+// Reads len(p) bytes at off, zeroing whatever couldn't be read. Returns
+// false if p couldn't be filled.
+func readAtPadded(in io.ReaderAt, p []byte, off int64) bool {
+	n, _ := in.ReadAt(p, off)
+	zero(p[n:])
+	return n == len(p)
+}
+
+func writeTable(out io.Writer, table [][]byte) error {
+	for _, leaf := range table {
+		_, err := out.Write(leaf)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func makeShards(n int, size int64) [][]byte {
+	shards := make([][]byte, n)
+	for i := range shards {
+		shards[i] = make([]byte, size)
+	}
+	return shards
+}
+
+func zero(p []byte) {
+	for i := range p {
+		p[i] = 0
+	}
+}
@@ -0,0 +1,246 @@
+package seal
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 125 chunks of 2 bytes, so two stripes with the last one partial.
+var parityData = strings.Repeat("0123456789", 25)
+
+// Seals parityData with 5% parity, returning the sealed bytes.
+func wrapParity(t *testing.T, variant string) (*Seal, []byte) {
+	f, err := ioutil.TempFile("", "seal")
+	require.Nil(t, err)
+	os.Remove(f.Name())
+	defer f.Close()
+
+	sl, err := WrapParity(strings.NewReader(parityData), f, variant, 256, 2, 5)
+	require.Nil(t, err)
+
+	_, err = f.Seek(0, 0)
+	require.Nil(t, err)
+	sealed, err := ioutil.ReadAll(f)
+	require.Nil(t, err)
+	return sl, sealed
+}
+
+func TestWrapParity(t *testing.T) {
+	for _, variant := range []string{VariantSHA256, treePrefix + VariantBLAKE3} {
+		sl, sealed := wrapParity(t, variant)
+		assert.Equal(t, 5, sl.Parity)
+		assert.True(t, strings.HasSuffix(sl.String(), " parity=5\n"))
+		// The second stripe of 50 bytes has parity chunks of 1 byte, and
+		// a table of the hashes of its 100 shards.
+		assert.Len(t, sealed, len(sl.String())+len(parityData)+125*32+5*2+5*1+10*32+100*32)
+
+		unwrapped := &bytes.Buffer{}
+		usl, err := Unwrap(bytes.NewReader(sealed), unwrapped)
+		require.Nil(t, err)
+		assert.Equal(t, sl, &usl.Seal)
+		assert.Equal(t, parityData, unwrapped.String())
+
+		ra, err := NewReaderAt(bytes.NewReader(sealed), int64(len(sealed)))
+		require.Nil(t, err)
+		assert.Nil(t, ra.Check())
+	}
+}
+
+// Parity stays in proportion to the content, however it falls into stripes.
+func TestWrapParityOverhead(t *testing.T) {
+	cases := []struct {
+		length, chunk int64
+		parity        int
+	}{
+		{10 << 10, 1 << 20, 5}, // Much less than a chunk.
+		{1, 4, 5},
+		{250, 2, 5},
+		{201, 2, 10},
+		{100*64 + 1, 64, 1},
+		{1000, 1, 100},
+	}
+
+	for _, c := range cases {
+		f, err := ioutil.TempFile("", "seal")
+		require.Nil(t, err)
+		os.Remove(f.Name())
+		defer f.Close()
+
+		content := strings.Repeat("x", int(c.length))
+		sl, err := WrapParity(strings.NewReader(content), f, VariantSHA256, 256, c.chunk, c.parity)
+		require.Nil(t, err)
+		info, err := f.Stat()
+		require.Nil(t, err)
+
+		// What rounding up the last stripe's shards adds is less than a
+		// byte per parity chunk.
+		_, tableLen := chunkTable(sl, sha256Algorithm(t))
+		overhead := info.Size() - int64(len(sl.String())) - c.length - tableLen -
+			parityChunks(sl)*32 - shardTableLen(sl, sha256Algorithm(t))
+		exact := c.length * int64(c.parity) / 100
+		assert.True(t, overhead >= exact && overhead <= exact+int64(c.parity),
+			"%d bytes at %d%%: %d bytes of parity", c.length, c.parity, overhead)
+
+		_, err = f.Seek(0, 0)
+		require.Nil(t, err)
+		out := &bytes.Buffer{}
+		_, err = Unwrap(f, out)
+		require.Nil(t, err)
+		assert.Equal(t, content, out.String())
+	}
+}
+
+func sha256Algorithm(t *testing.T) *Algorithm {
+	algo, err := LookupAlgorithm(VariantSHA256)
+	require.Nil(t, err)
+	return algo
+}
+
+func TestWrapParityBad(t *testing.T) {
+	for _, parity := range []int{0, -1, ParityStripe + 1} {
+		_, err := WrapParity(strings.NewReader(parityData), nil, VariantSHA256, 256, 2, parity)
+		assert.Equal(t, ErrBadParity, err)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	sl, sealed := wrapParity(t, VariantSHA256)
+	offset := len(sl.String())
+	tableOff := offset + len(parityData)
+	parityOff := tableOff + 125*32
+
+	cases := []struct {
+		corrupt  []int // Offsets in the sealed file.
+		repaired []Range
+	}{
+		{nil, nil},
+		// Adjacent chunks in the first stripe and one in the second.
+		{[]int{offset + 10, offset + 13, offset + 249}, []Range{{10, 4}, {248, 2}}},
+		// Five chunks is as many as a stripe can lose.
+		{[]int{offset, offset + 20, offset + 40, offset + 60, offset + 80}, []Range{{0, 2}, {20, 2}, {40, 2}, {60, 2}, {80, 2}}},
+		// Only the tables and parity are corrupt, including the 1 byte
+		// parity of the second stripe.
+		{[]int{tableOff + 5, parityOff, parityOff + 12, len(sealed) - 1}, nil},
+	}
+
+	for _, c := range cases {
+		broken := append([]byte(nil), sealed...)
+		for _, off := range c.corrupt {
+			broken[off] ^= 0xff
+		}
+
+		out := &bytes.Buffer{}
+		repaired, err := Repair(bytes.NewReader(broken), out)
+		require.Nil(t, err, "%v", c.corrupt)
+		assert.Equal(t, c.repaired, repaired)
+		assert.Equal(t, sealed, out.Bytes())
+	}
+}
+
+// A short stripe has smaller shards, so a chunk spans several of them, but
+// only the shards that are corrupt are rebuilt.
+func TestRepairShortStripe(t *testing.T) {
+	f, err := ioutil.TempFile("", "seal")
+	require.Nil(t, err)
+	os.Remove(f.Name())
+	defer f.Close()
+
+	// 25 chunks of 20 bytes, in shards of 5 bytes.
+	content := strings.Repeat("0123456789", 50)
+	sl, err := WrapParity(strings.NewReader(content), f, VariantSHA256, 256, 20, 10)
+	require.Nil(t, err)
+	_, err = f.Seek(0, 0)
+	require.Nil(t, err)
+	sealed, err := ioutil.ReadAll(f)
+	require.Nil(t, err)
+	offset := len(sl.String())
+	shardTableOff := len(sealed) - 100*32
+
+	cases := []struct {
+		corrupt  []int // Offsets in the sealed file.
+		repaired []Range
+		err      error
+	}{
+		{[]int{offset + 25, offset + 100, offset + 499}, []Range{{20, 20}, {100, 20}, {480, 20}}, nil},
+		// Ten parity shards rebuild ten shards, but not eleven.
+		{[]int{offset, offset + 5, offset + 10, offset + 15, offset + 20, offset + 25,
+			offset + 30, offset + 35, offset + 40, offset + 45}, []Range{{0, 60}}, nil},
+		{[]int{offset, offset + 5, offset + 10, offset + 15, offset + 20, offset + 25,
+			offset + 30, offset + 35, offset + 40, offset + 45, offset + 50}, nil, ErrUnrepairable},
+		// A corrupt shard table alone loses nothing.
+		{[]int{shardTableOff, shardTableOff + 32*50, len(sealed) - 1}, nil, nil},
+	}
+
+	for _, c := range cases {
+		broken := append([]byte(nil), sealed...)
+		for _, off := range c.corrupt {
+			broken[off] ^= 0xff
+		}
+
+		out := &bytes.Buffer{}
+		repaired, err := Repair(bytes.NewReader(broken), out)
+		assert.Equal(t, c.err, err, "%v", c.corrupt)
+		if err == nil {
+			assert.Equal(t, c.repaired, repaired)
+			assert.Equal(t, sealed, out.Bytes())
+		}
+	}
+
+	// Memory is sized from the content that's there, not the header.
+	_, err = Repair(bytes.NewReader(sealed[:offset+400]), ioutil.Discard)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+// A seal whose content is less than a chunk can still be repaired, since its
+// shards are hashed.
+func TestRepairSmall(t *testing.T) {
+	f, err := ioutil.TempFile("", "seal")
+	require.Nil(t, err)
+	os.Remove(f.Name())
+	defer f.Close()
+
+	content := strings.Repeat("seal!", 2000)
+	_, err = Wrap(strings.NewReader(content), f, WithAlgorithm(VariantSHA256), WithParity(5))
+	require.Nil(t, err)
+	_, err = f.Seek(0, 0)
+	require.Nil(t, err)
+	sealed, err := ioutil.ReadAll(f)
+	require.Nil(t, err)
+	sl, err := ReadHeader(bytes.NewReader(sealed))
+	require.Nil(t, err)
+	require.Equal(t, int64(DefaultChunkSize), sl.ChunkSize)
+
+	broken := append([]byte(nil), sealed...)
+	broken[len(sl.String())+1234] ^= 0x01
+	out := &bytes.Buffer{}
+	repaired, err := Repair(bytes.NewReader(broken), out)
+	require.Nil(t, err)
+	assert.Equal(t, []Range{{0, int64(len(content))}}, repaired)
+	assert.Equal(t, sealed, out.Bytes())
+}
+
+func TestRepairBad(t *testing.T) {
+	sl, sealed := wrapParity(t, treePrefix+VariantSHA256)
+	offset := len(sl.String())
+
+	broken := append([]byte(nil), sealed...)
+	for i := 0; i < 6; i++ {
+		broken[offset+i*2] ^= 0xff
+	}
+	_, err := Repair(bytes.NewReader(broken), ioutil.Discard)
+	assert.Equal(t, ErrUnrepairable, err)
+
+	_, err = Repair(bytes.NewReader(sealed[:len(sealed)-200]), ioutil.Discard)
+	assert.Nil(t, err)
+
+	c := goodCases[1]
+	_, err = Repair(strings.NewReader(c.header+c.data), ioutil.Discard)
+	assert.Equal(t, ErrNotChunked, err)
+}
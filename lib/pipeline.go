@@ -0,0 +1,185 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// The most buffers a pipeline has in flight. Two are enough to overlap reading
+// with writing; a few more absorb the stages running at uneven speeds.
+const pipelineDepth = 4
+
+// Buffers of the default size are reused between pipelines.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return make([]byte, defaultBufferSize) },
+}
+
+func getBuffer(size int) []byte {
+	if size == defaultBufferSize {
+		return bufferPool.Get().([]byte)
+	}
+	return make([]byte, size)
+}
+
+func putBuffer(p []byte) {
+	if cap(p) == defaultBufferSize {
+		bufferPool.Put(p[:defaultBufferSize])
+	}
+}
+
+// A filled buffer, which is released once every writer is done with it.
+type block struct {
+	p    []byte
+	refs int32
+}
+
+// Copies `in` to every writer through buffers of bufSize bytes. The calling
+// goroutine reads, and each writer runs on its own goroutine, so reading,
+// writing the output and hashing all overlap. Writers see the same data in the
+// same order as if they were written to in turn.
+//
+// Returns the number of bytes read and the first error. The error from `in`
+// is returned even if a writer also failed, and once a writer fails, the rest
+// of the input isn't read. Nothing is left running when it returns, even if
+// `in` or a writer panics; a writer's panic is raised again by pipeline.
+func pipeline(in io.Reader, bufSize int, ws ...io.Writer) (int64, error) {
+	free := make(chan []byte, pipelineDepth)
+	allocated := 0
+
+	stop := make(chan struct{})
+	var once sync.Once
+	var werr error
+	fail := func(err error) {
+		once.Do(func() {
+			werr = err
+			close(stop)
+		})
+	}
+
+	var wg sync.WaitGroup
+	queues := make([]chan *block, len(ws))
+	for i, w := range ws {
+		queues[i] = make(chan *block, pipelineDepth)
+		wg.Add(1)
+		go func(w io.Writer, queue <-chan *block) {
+			defer wg.Done()
+			for b := range queue {
+				select {
+				case <-stop:
+				default:
+					err := write(w, b.p)
+					if err != nil {
+						fail(err)
+					}
+				}
+				if atomic.AddInt32(&b.refs, -1) == 0 {
+					free <- b.p
+				}
+			}
+		}(w, queues[i])
+	}
+
+	// The writers are stopped before their buffers are reused, however the
+	// reading ends. A buffer held by the reader when it panics isn't reused.
+	stopped := false
+	shutdown := func() {
+		if stopped {
+			return
+		}
+		stopped = true
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+		for len(free) > 0 {
+			putBuffer(<-free)
+		}
+	}
+	defer shutdown()
+
+	var n int64
+	var rerr error
+	for rerr == nil {
+		var p []byte
+		select {
+		case p = <-free:
+		case <-stop:
+		default:
+			if allocated < pipelineDepth {
+				p = getBuffer(bufSize)
+				allocated++
+				break
+			}
+			select {
+			case p = <-free:
+			case <-stop:
+			}
+		}
+		if p == nil {
+			break
+		}
+
+		var m int
+		m, rerr = fill(in, p[:cap(p)])
+		if m == 0 {
+			free <- p
+			continue
+		}
+		n += int64(m)
+		b := &block{p: p[:m], refs: int32(len(ws))}
+		for _, queue := range queues {
+			queue <- b
+		}
+	}
+
+	shutdown()
+	if p, ok := werr.(*writerPanic); ok {
+		panic(p.value)
+	}
+
+	if rerr == io.EOF {
+		rerr = nil
+	}
+	if rerr != nil {
+		return n, rerr
+	}
+	return n, werr
+}
+
+// A panic in a writer of a pipeline, which stops the pipeline like an error.
+type writerPanic struct {
+	value interface{}
+}
+
+func (p *writerPanic) Error() string {
+	return fmt.Sprint("seal: writer panicked: ", p.value)
+}
+
+// Writes p to w, returning a panic as a *writerPanic.
+func write(w io.Writer, p []byte) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &writerPanic{v}
+		}
+	}()
+	_, err = w.Write(p)
+	return err
+}
+
+// Reads from `in` until p is full or there's an error.
+func fill(in io.Reader, p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		m, err := in.Read(p[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
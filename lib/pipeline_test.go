@@ -0,0 +1,103 @@
+package seal
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline(t *testing.T) {
+	data := strings.Repeat(treeData, 1000)
+	for _, size := range []int{1, 7, 4096, len(data), defaultBufferSize} {
+		for _, in := range []io.Reader{
+			strings.NewReader(data),
+			iotest.OneByteReader(strings.NewReader(data)),
+			iotest.DataErrReader(strings.NewReader(data)),
+		} {
+			out := &bytes.Buffer{}
+			h := sha512.New()
+			n, err := pipeline(in, size, out, h)
+			require.Nil(t, err)
+			assert.Equal(t, int64(len(data)), n)
+			assert.Equal(t, data, out.String())
+			sum := sha512.Sum512([]byte(data))
+			assert.Equal(t, sum[:], h.Sum(nil))
+		}
+	}
+}
+
+type failingWriter struct {
+	n   int
+	err error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n < len(p) {
+		return 0, w.err
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestPipelineErrors(t *testing.T) {
+	errWrite := errors.New("write failed")
+	errRead := errors.New("read failed")
+	data := strings.Repeat(treeData, 1000)
+
+	// Nothing more is read once a writer fails.
+	in := &countingReader{r: strings.NewReader(data)}
+	out := &bytes.Buffer{}
+	_, err := pipeline(in, 10, out, &failingWriter{n: 100, err: errWrite})
+	assert.Equal(t, errWrite, err)
+	assert.True(t, in.n < len(data), "read %d bytes", in.n)
+
+	// Data read before an error is written.
+	r := io.MultiReader(strings.NewReader(data), iotest.ErrReader(errRead))
+	out.Reset()
+	n, err := pipeline(r, 64, out)
+	assert.Equal(t, errRead, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, data, out.String())
+}
+
+type panickingReader struct{}
+
+func (panickingReader) Read(p []byte) (int, error) {
+	panic("read panicked")
+}
+
+type panickingWriter struct{}
+
+func (panickingWriter) Write(p []byte) (int, error) {
+	panic("write panicked")
+}
+
+// Returns what f panicked with.
+func recovered(f func()) (v interface{}) {
+	defer func() { v = recover() }()
+	f()
+	return nil
+}
+
+func TestPipelinePanics(t *testing.T) {
+	data := strings.Repeat(treeData, 1000)
+
+	// The panic reaches the caller, rather than leaving the writers blocked.
+	v := recovered(func() {
+		r := io.MultiReader(strings.NewReader(data), panickingReader{})
+		pipeline(r, 10, &bytes.Buffer{}, sha512.New())
+	})
+	assert.Equal(t, "read panicked", v)
+
+	v = recovered(func() {
+		pipeline(strings.NewReader(data), 10, &bytes.Buffer{}, panickingWriter{})
+	})
+	assert.Equal(t, "write panicked", v)
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"hash"
+	"io"
+)
+
+var ErrTrailingData = errors.New("seal: unexpected data after content")
+
+// Reader streams the content of a sealed file while verifying it. The
+// header is parsed when the Reader is created. Once all content has been
+// read, Read returns io.EOF if the claim is valid and ErrSealBroken if not,
+// so a broken seal never looks like a clean end of stream. If the size of the
+// input is known, a seal shorter than the length in its header fails with
+// io.ErrUnexpectedEOF on the first Read, before any content is returned.
+//
+// Both the header and trailer layouts are supported.
+type Reader struct {
+	// CalculatedSignature is only set once the content has been read.
+	UnwrappedSeal
+
+	in      io.Reader
+	trailer *trailerReader
+	rest    *bufio.Reader // What follows the content, if its length is known.
+	chunks  *treeHash     // Calculates the chunk hashes to compare to the table.
+	n       int64
+	avail   int64 // The bytes left after the header, or -1 if unknown.
+	ver     verifier
+	hashers []io.Writer // The verifier, and chunks if they are separate.
+	err     error
+}
+
+// Checks content written to it against a claim.
+type verifier interface {
+	io.Writer
+
+	// Returns the calculated claim, if the variant has one, and
+	// ErrSealBroken if it doesn't match.
+	verify(claim []byte) ([]byte, error)
+}
+
+type hashVerifier struct {
+	hash.Hash
+}
+
+func (v hashVerifier) verify(claim []byte) ([]byte, error) {
+	calc := v.Sum(nil)[:len(claim)]
+	if !bytes.Equal(calc, claim) {
+		return calc, ErrSealBroken
+	}
+	return calc, nil
+}
+
+// Signify signatures can only be checked over the whole message, so the
+// content is buffered.
+type signifyVerifier struct {
+	bytes.Buffer
+	key *PublicKey
+}
+
+func (v *signifyVerifier) verify(claim []byte) ([]byte, error) {
+	return nil, v.key.Verify(v.Bytes(), claim)
+}
+
+// Parses the seal header from `in` and returns a Reader for the content.
+// Signify seals need a public key; use NewSignifyReader for those.
+func NewReader(in io.Reader) (*Reader, error) {
+	r, err := newReader(in)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Variant == VariantSignify {
+		return nil, ErrPublicKeyRequired
+	}
+
+	if r.ChunkSize > 0 {
+		algo, err := tableAlgorithm(r.VariantName())
+		if err != nil {
+			return nil, err
+		}
+
+		// A short table is found before the content is streamed, like
+		// short content.
+		_, size := chunkTable(&r.Seal, algo)
+		if r.err == nil && r.avail >= 0 && r.avail-r.Length < size {
+			r.err = io.ErrUnexpectedEOF
+		}
+
+		r.chunks = newTreeHash(algo, r.ChunkSize)
+		if isTreeVariant(r.VariantName()) {
+			r.setVerifier(hashVerifier{r.chunks})
+		} else {
+			r.setVerifier(hashVerifier{algo.New()})
+			r.hashers = append(r.hashers, r.chunks)
+		}
+		return r, nil
+	}
+
+	algo, err := LookupAlgorithm(r.VariantName())
+	if err != nil {
+		return nil, err
+	}
+
+	r.setVerifier(hashVerifier{algo.New()})
+	return r, nil
+}
+
+// Same as NewReader, but for a signify seal, which is verified with key.
+// The content is held in memory until it has been verified.
+func NewSignifyReader(in io.Reader, key *PublicKey) (*Reader, error) {
+	r, err := newReader(in)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Variant != VariantSignify {
+		return nil, ErrNotSigned
+	}
+
+	r.setVerifier(&signifyVerifier{key: key})
+	return r, nil
+}
+
+func newReader(in io.Reader) (*Reader, error) {
+	bufIn := bufio.NewReader(in)
+
+	sl, err := parseHeader(bufIn)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reader{UnwrappedSeal: UnwrappedSeal{Seal: *sl}, in: bufIn, avail: -1}
+	if size := inputSize(in); size >= 0 {
+		r.avail = size + int64(bufIn.Buffered())
+	}
+	if sl.TrailerLen > 0 {
+		r.trailer = &trailerReader{in: bufIn, n: trailerLen(sl)}
+		r.in = r.trailer
+	}
+	if sl.ChunkSize > 0 || sl.Metadata != nil {
+		r.in = io.LimitReader(bufIn, sl.Length)
+		r.rest = bufIn
+
+		// The declared length is checked against the size of the input
+		// up front, so a truncated seal is reported before any of its
+		// content is.
+		if r.avail >= 0 && r.avail < sl.Length {
+			r.err = io.ErrUnexpectedEOF
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Reader) setVerifier(v verifier) {
+	r.ver, r.hashers = v, []io.Writer{v}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.in.Read(p)
+	for _, h := range r.hashers {
+		h.Write(p[:n])
+	}
+	r.n += int64(n)
+
+	if err == io.EOF {
+		err = r.finish()
+	}
+
+	r.err = err
+	return n, err
+}
+
+// Writes the rest of the content to w and verifies it, returning the number
+// of bytes written. Reading, writing and each hash run on their own
+// goroutines. Unlike Read, a valid claim returns nil rather than io.EOF.
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+	if r.err == io.EOF {
+		return 0, nil
+	} else if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := pipeline(r.in, defaultBufferSize, append([]io.Writer{w}, r.hashers...)...)
+	r.n += n
+	if err == nil {
+		err = r.finish()
+	}
+
+	r.err = err
+	if err == io.EOF {
+		return n, nil
+	}
+	return n, err
+}
+
+// Checks the claim once all content has been read.
+func (r *Reader) finish() error {
+	if r.trailer != nil {
+		err := parseTrailer(&r.Seal, r.trailer.buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	var table [][]byte
+	if r.rest != nil {
+		if r.n < r.Length {
+			return io.ErrUnexpectedEOF
+		}
+
+		var err error
+		if r.ChunkSize > 0 {
+			table, err = r.readTable()
+		} else if _, err = r.rest.Peek(1); err == io.EOF {
+			err = nil
+		} else if err == nil {
+			err = ErrTrailingData
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	r.ver.Write(r.coveredAttributes())
+
+	var err error
+	r.CalculatedSignature, err = r.ver.verify(r.ClaimedSignature)
+	if err == ErrSealBroken && table != nil {
+		bad := corruptRanges(&r.Seal, r.chunks.Leaves(), table)
+		if len(bad) > 0 {
+			err = &CorruptionError{Ranges: bad}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// Reads the chunk table, which is only used to locate corruption if the
+// claim doesn't hold.
+func (r *Reader) readTable() ([][]byte, error) {
+	_, size := chunkTable(&r.Seal, r.chunks.algo)
+	table := make([]byte, size)
+	_, err := io.ReadFull(r.rest, table)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return splitTable(table, r.chunks.algo.MaxBytes), nil
+}
+
+// Reads all but the last n bytes of a stream, which are left in buf at EOF.
+type trailerReader struct {
+	in  io.Reader
+	n   int
+	buf []byte
+	err error
+}
+
+func (t *trailerReader) Read(p []byte) (int, error) {
+	if t.buf == nil {
+		t.buf = make([]byte, 0, t.n+32*1024)
+	}
+
+	for len(t.buf) <= t.n && t.err == nil {
+		var m int
+		m, t.err = t.in.Read(t.buf[len(t.buf):cap(t.buf)])
+		t.buf = t.buf[:len(t.buf)+m]
+	}
+
+	if len(t.buf) > t.n {
+		m := copy(p, t.buf[:len(t.buf)-t.n])
+		t.buf = t.buf[:copy(t.buf, t.buf[m:])]
+		return m, nil
+	}
+
+	if t.err == io.EOF && len(t.buf) < t.n {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return 0, t.err
+}
@@ -0,0 +1,82 @@
+package seal
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderGood(t *testing.T) {
+	for _, c := range goodCases {
+		r, err := NewReader(bytes.NewBufferString(c.header + c.data))
+		require.Nil(t, err)
+		assert.Equal(t, c.seal, &r.Seal)
+		assert.Nil(t, r.CalculatedSignature)
+
+		data, err := ioutil.ReadAll(r)
+		require.Nil(t, err)
+		assert.Equal(t, c.data, string(data))
+		assert.Equal(t, c.seal.ClaimedSignature, r.CalculatedSignature)
+
+		n, err := r.Read(make([]byte, 1))
+		assert.Equal(t, 0, n)
+		assert.Equal(t, io.EOF, err)
+	}
+}
+
+func TestReaderBroken(t *testing.T) {
+	c := goodCases[1]
+	r, err := NewReader(bytes.NewBufferString(c.header + "SEAL!\n"))
+	require.Nil(t, err)
+
+	data, err := ioutil.ReadAll(r)
+	assert.Equal(t, ErrSealBroken, err)
+	assert.Equal(t, "SEAL!\n", string(data))
+
+	_, err = r.Read(make([]byte, 1))
+	assert.Equal(t, ErrSealBroken, err)
+}
+
+func TestReaderWriteTo(t *testing.T) {
+	for _, c := range goodCases {
+		r, err := NewReader(bytes.NewBufferString(c.header + c.data))
+		require.Nil(t, err)
+
+		// What's left after a Read is written.
+		p := make([]byte, 1)
+		n := 0
+		if c.data != "" {
+			n, err = r.Read(p)
+			require.Nil(t, err)
+		}
+		out := bytes.NewBuffer(p[:n])
+		m, err := r.WriteTo(out)
+		require.Nil(t, err)
+		assert.Equal(t, int64(len(c.data)-n), m)
+		assert.Equal(t, c.data, out.String())
+		assert.Equal(t, c.seal.ClaimedSignature, r.CalculatedSignature)
+
+		_, err = r.Read(p)
+		assert.Equal(t, io.EOF, err)
+	}
+
+	c := goodCases[1]
+	r, err := NewReader(bytes.NewBufferString(c.header + "SEAL!\n"))
+	require.Nil(t, err)
+	_, err = r.WriteTo(ioutil.Discard)
+	assert.Equal(t, ErrSealBroken, err)
+	_, err = r.WriteTo(ioutil.Discard)
+	assert.Equal(t, ErrSealBroken, err)
+}
+
+func TestReaderBadHeader(t *testing.T) {
+	_, err := NewReader(bytes.NewBufferString("SL%v0{zz}\nseal!\n"))
+	assert.NotNil(t, err)
+
+	_, err = NewReader(bytes.NewBufferString("not a seal\n"))
+	assert.NotNil(t, err)
+}
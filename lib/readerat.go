@@ -0,0 +1,217 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"hash"
+	"io"
+	"sync"
+)
+
+var ErrNotChunked = errors.New("seal: seal has no chunk table")
+
+// ReaderAt gives random access to the content of a seal with a chunk table.
+// Only the chunks touched by a read are verified, and a read that touches a
+// corrupt chunk fails with a *CorruptionError.
+//
+// The chunk table of a merkle seal is checked against the claim when the
+// ReaderAt is created. Other variants don't cover their table, so a corrupt
+// table can make intact chunks look corrupt; Check resolves this by also
+// verifying the claim.
+type ReaderAt struct {
+	Seal
+
+	in     io.ReaderAt
+	offset int64 // Start of the content.
+	algo   *Algorithm
+	leaves [][]byte
+	bufs   sync.Pool // Of chunk buffers, so concurrent reads don't share one.
+}
+
+// Parses the header and chunk table of the seal in `in`, which is size bytes
+// long. The content is not read.
+func NewReaderAt(in io.ReaderAt, size int64) (*ReaderAt, error) {
+	header, sl, err := readHeaderAt(in, size)
+	if err != nil {
+		return nil, err
+	}
+	if sl.ChunkSize == 0 {
+		return nil, ErrNotChunked
+	}
+
+	algo, err := tableAlgorithm(sl.VariantName())
+	if err != nil {
+		return nil, err
+	}
+
+	ra := &ReaderAt{Seal: *sl, in: in, offset: int64(len(header)), algo: algo}
+
+	_, tableLen := chunkTable(sl, algo)
+	if ra.offset+sl.Length+tableLen+paritySize(sl, algo) != size {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	// The chunk size comes from the header, so buffers are no larger than
+	// the content, which has been checked against the size of `in`.
+	bufSize := sl.ChunkSize
+	if bufSize > sl.Length {
+		bufSize = sl.Length
+	}
+	ra.bufs.New = func() interface{} { return make([]byte, bufSize) }
+
+	table := make([]byte, tableLen)
+	_, err = in.ReadAt(table, ra.offset+sl.Length)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	ra.leaves = splitTable(table, algo.MaxBytes)
+
+	if isTreeVariant(sl.VariantName()) &&
+		!bytes.Equal(merkleRoot(algo, ra.leaves), sl.ClaimedSignature) {
+		return nil, ErrBadChunkTable
+	}
+
+	return ra, nil
+}
+
+// Reads and parses the header at the start of `in`, which is size bytes long.
+func readHeaderAt(in io.ReaderAt, size int64) ([]byte, *Seal, error) {
+	header, err := readHeaderLine(bufio.NewReader(io.NewSectionReader(in, 0, size)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sl, err := parseHeaderLine(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, sl, nil
+}
+
+// Returns the size of the sealed content.
+func (ra *ReaderAt) Size() int64 {
+	return ra.Length
+}
+
+// Reads len(p) bytes of content starting at off, verifying every chunk the
+// read touches.
+func (ra *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("seal: negative offset")
+	}
+	if off >= ra.Length {
+		return 0, io.EOF
+	}
+
+	end := off + int64(len(p))
+	var err error
+	if end > ra.Length {
+		end = ra.Length
+		err = io.EOF
+	}
+
+	buf := ra.bufs.Get().([]byte)
+	defer ra.bufs.Put(buf)
+	n := 0
+	for pos := off; pos < end; {
+		i := pos / ra.ChunkSize
+		chunk, cerr := ra.chunk(i, buf)
+		if cerr == ErrSealBroken {
+			cerr = &CorruptionError{Ranges: []Range{
+				{Offset: i * ra.ChunkSize, Length: int64(len(chunk))},
+			}}
+		}
+		if cerr != nil {
+			return n, cerr
+		}
+
+		m := copy(p[n:end-off], chunk[pos-i*ra.ChunkSize:])
+		n += m
+		pos += int64(m)
+	}
+
+	return n, err
+}
+
+// Verifies every chunk. If any are corrupt, a *CorruptionError listing them
+// is returned. For variants other than merkle, the claim is verified as well;
+// if the claim holds, the content is intact and only the table is corrupt.
+func (ra *ReaderAt) Check() error {
+	return ra.check(context.Background(), nil)
+}
+
+// Implements Check and CheckContext. progress may be nil.
+func (ra *ReaderAt) check(ctx context.Context, progress func(done, total int64)) error {
+	var bad []Range
+	var digest hash.Hash
+	if !isTreeVariant(ra.VariantName()) {
+		digest = ra.algo.New()
+	}
+
+	buf := ra.bufs.Get().([]byte)
+	defer ra.bufs.Put(buf)
+	var done int64
+	for i := range ra.leaves {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		chunk, err := ra.chunk(int64(i), buf)
+		if err == ErrSealBroken {
+			bad = addRange(bad, int64(i)*ra.ChunkSize, int64(len(chunk)))
+		} else if err != nil {
+			return err
+		}
+
+		if digest != nil {
+			digest.Write(chunk)
+		}
+		done += int64(len(chunk))
+		if progress != nil {
+			progress(done, ra.Length)
+		}
+	}
+
+	if digest != nil {
+		digest.Write(ra.coveredAttributes())
+		_, err := hashVerifier{digest}.verify(ra.ClaimedSignature)
+		if err == nil || len(bad) == 0 {
+			return err
+		}
+	}
+
+	if len(bad) > 0 {
+		return &CorruptionError{Ranges: bad}
+	}
+	return nil
+}
+
+// Reads and verifies chunk i into buf. The chunk is returned along with
+// ErrSealBroken if it is corrupt.
+func (ra *ReaderAt) chunk(i int64, buf []byte) ([]byte, error) {
+	start := i * ra.ChunkSize
+	size := ra.ChunkSize
+	if size > ra.Length-start {
+		size = ra.Length - start
+	}
+	buf = buf[:size]
+
+	n, err := ra.in.ReadAt(buf, ra.offset+start)
+	if n < len(buf) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	if !bytes.Equal(leafHash(ra.algo, buf), ra.leaves[i]) {
+		return buf, ErrSealBroken
+	}
+	return buf, nil
+}
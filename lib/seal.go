@@ -5,14 +5,14 @@ package seal
 
 import (
 	"bufio"
-	"bytes"
 	"crypto/sha512"
-	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
 )
 
 const Magic = `SL%v`
@@ -25,13 +25,35 @@ const DefaultSealBits = 512
 var ErrSealBroken = errors.New("seal: claim did not validate against content")
 var ErrBadSignatureLength = errors.New("seal: signature length is invalid")
 
+// The largest claim of any built-in hash algorithm.
 const maxBytes = sha512.Size
 
 // Seal is the information stored in the seal header.
 type Seal struct {
-	Magic            string
-	Version          int
+	Magic   string
+	Version int
+	// Variant is empty for the sha512 short form.
+	Variant          string
 	ClaimedSignature []byte
+
+	// TrailerLen is the length in bytes of a claim that follows the content
+	// instead of being in the header, or 0 if the claim is in the header.
+	// When reading, ClaimedSignature is only known once the content has been
+	// read.
+	TrailerLen int
+
+	// ChunkSize is set for seals with a chunk table, which follows Length
+	// bytes of content. Merkle seals always have one.
+	ChunkSize int64
+	Length    int64
+
+	// Parity is the number of parity chunks per stripe of ParityStripe
+	// chunks, or 0 if the seal has no parity. It requires a chunk table.
+	Parity int
+
+	// Metadata is nil unless the file's metadata was recorded, in which
+	// case Length is also set.
+	Metadata *Metadata
 }
 
 // UnwrappedSeal extends Seal to provide the calculated signature of the
@@ -45,115 +67,306 @@ func (sl *Seal) Bytes() []byte {
 	return []byte(sl.String())
 }
 
+// Returns the name of the seal's variant, resolving the short form.
+func (sl *Seal) VariantName() string {
+	if sl.Variant == "" {
+		return DefaultVariant
+	}
+	return sl.Variant
+}
+
+// Returns the header line, in the short form if Variant is empty and in the
+// long form otherwise. Panics if the variant is not registered.
 func (sl *Seal) String() string {
-	return fmt.Sprintf("%s%d{%s}\n", sl.Magic, sl.Version,
-		hex.EncodeToString(sl.ClaimedSignature))
+	if sl.TrailerLen > 0 {
+		return sl.line("~" + strconv.Itoa(sl.TrailerLen))
+	}
+	return sl.claimLine()
 }
 
-// Wrap the contents of `in` with a Seal header, and write the full Seal
-// file to `out`. Uses the default number of bits.
-func Wrap(in io.Reader, out io.WriteSeeker) (*Seal, error) {
-	return WrapBits(in, out, DefaultSealBits)
+// Returns the line holding the claim, which is the header unless the claim
+// is in a trailer.
+func (sl *Seal) claimLine() string {
+	v, err := LookupVariant(sl.VariantName())
+	if err != nil {
+		panic(err)
+	}
+	return sl.line(v.EncodeClaim(sl.ClaimedSignature))
 }
 
-func WrapBits(in io.Reader, out io.WriteSeeker, bits int) (*Seal, error) {
-	var err error
+func (sl *Seal) line(claim string) string {
+	if sl.Variant != "" {
+		claim = sl.Variant + ":" + claim
+	}
+	return fmt.Sprintf("%s%d{%s}%s\n", sl.Magic, sl.Version, claim,
+		sl.attributes())
+}
 
-	sigLen := bitsToBytes(bits)
-	if sigLen == -1 {
-		return nil, ErrBadSignatureLength
+// Returns the header attributes that follow the claim. Sizes that are only
+// known after the content has been written are zero-padded so the header
+// length doesn't change.
+func (sl *Seal) attributes() string {
+	attrs := ""
+	if sl.ChunkSize > 0 {
+		attrs += fmt.Sprintf(" chunk=%d", sl.ChunkSize)
 	}
+	if sl.ChunkSize > 0 || sl.Metadata != nil {
+		attrs += fmt.Sprintf(" length=%019d", sl.Length)
+	}
+	if sl.Parity > 0 {
+		attrs += fmt.Sprintf(" parity=%d", sl.Parity)
+	}
+	if sl.Metadata != nil {
+		attrs += sl.Metadata.attributes()
+	}
+	return attrs
+}
+
+// Wrap the contents of `in` with a Seal header, and write the full Seal
+// file to `out`. By default the claim is a full-length sha512 digest, which
+// opts can change.
+//
+// If `out` can seek, the content is written first, and the header is written
+// over a placeholder once the claim is known. Otherwise the seal is streamed
+// with the trailer layout like Writer, unless it records metadata, in which
+// case it's buffered in a temporary file.
+func Wrap(in io.Reader, out io.Writer, opts ...Option) (*Seal, error) {
+	c := newWrapConfig(opts)
+	return c.wrap(c.input(in), out)
+}
 
-	contentOffset := headerLen(sigLen)
+func (c *wrapConfig) wrap(in io.Reader, out io.Writer) (*Seal, error) {
+	if c.signer != nil {
+		if c.meta != nil {
+			return nil, errors.New("seal: signify seals can't record metadata")
+		}
+		if c.chunked() {
+			return nil, errors.New("seal: signify seals can't have a chunk table")
+		}
+		return wrapSignify(in, out, c.signer)
+	}
+	if c.meta != nil && !validName(c.meta.Name) {
+		return nil, fmt.Errorf("seal: invalid file name: %q", c.meta.Name)
+	}
+	if c.chunked() {
+		return c.wrapChunked(in, out)
+	}
 
-	_, err = out.Seek(int64(contentOffset), 0)
+	a, err := LookupAlgorithm(c.algo)
 	if err != nil {
 		return nil, err
 	}
-
-	calc, err := teesum(in, out)
+	sigLen, err := c.sigLen(a)
 	if err != nil {
 		return nil, err
 	}
 
+	if ws, ok := seekable(out); ok {
+		return c.wrapSeeker(in, ws, a, sigLen)
+	}
+	if c.meta != nil {
+		return c.wrapBuffered(in, out)
+	}
+	return c.wrapStream(in, out, sigLen)
+}
+
+// Returns `out` as an io.WriteSeeker if it can seek. Pipes and terminals are
+// files, but can't.
+func seekable(out io.Writer) (io.WriteSeeker, bool) {
+	ws, ok := out.(io.WriteSeeker)
+	if !ok {
+		return nil, false
+	}
+	_, err := ws.Seek(0, io.SeekCurrent)
+	return ws, err == nil
+}
+
+// Writes the content after room for the header, then seeks back to write the
+// header once the claim is known.
+func (c *wrapConfig) wrapSeeker(in io.Reader, out io.WriteSeeker, a *Algorithm, sigLen int) (*Seal, error) {
 	sl := &Seal{
 		Magic:            Magic,
 		Version:          Version,
-		ClaimedSignature: calc[:sigLen],
+		ClaimedSignature: make([]byte, sigLen),
+		Metadata:         c.meta,
+	}
+	if c.algo != DefaultVariant {
+		sl.Variant = c.algo
 	}
 
-	_, err = out.Seek(0, 0)
+	_, err := out.Seek(int64(len(sl.String())), io.SeekStart)
 	if err != nil {
 		return nil, err
 	}
-	_, err = out.Write(sl.Bytes())
 
+	digest := a.New()
+	n, err := teesum(in, out, digest, c.bufSize)
+	if err != nil {
+		return nil, err
+	}
+	if c.meta != nil {
+		sl.Length = n
+	}
+
+	digest.Write(sl.coveredAttributes())
+	sl.ClaimedSignature = digest.Sum(nil)[:sigLen]
+
+	_, err = out.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	_, err = out.Write(sl.Bytes())
 	return sl, err
 }
 
-// Same as Wrap, but uses a temporary file to buffer the output because
-// `out` is not seekable.
-func WrapBuffered(in io.Reader, out io.Writer) (*Seal, error) {
-	return WrapBufferedBits(in, out, DefaultSealBits)
-}
+// Writes the content and its chunk table, and then the parity if there is
+// any, to `out`, which is read back for the parity.
+func (c *wrapConfig) wrapChunked(in io.Reader, out io.Writer) (*Seal, error) {
+	// The claim covers metadata by hashing it after the content, which a
+	// merkle root can't.
+	if c.meta != nil && isTreeVariant(c.algo) {
+		return nil, errors.New("seal: merkle seals can't record metadata")
+	}
+	chunk := c.chunk
+	if !c.hasChunk {
+		chunk = DefaultChunkSize
+	}
+	if chunk <= 0 || chunk > MaxChunkSize {
+		return nil, ErrBadChunkSize
+	}
+	if c.hasParity && (c.parity < 1 || c.parity > ParityStripe) {
+		return nil, ErrBadParity
+	}
 
-func WrapBufferedBits(in io.Reader, out io.Writer, bits int) (*Seal, error) {
-	tmp, err := ioutil.TempFile("", "seal")
-	defer tmp.Close()
-	defer os.Remove(tmp.Name())
+	a, err := tableAlgorithm(c.algo)
 	if err != nil {
 		return nil, err
 	}
+	bits := a.MaxBytes * 8
+	if c.hasBits {
+		bits = c.bits
+	}
 
-	// Do the actual wrapping, but output to a temporary file.
-	sl, err := WrapBits(in, tmp, bits)
-	if err != nil {
-		return sl, err
+	ws, ok := seekable(out)
+	rws, readable := out.(io.ReadWriteSeeker)
+	if !ok || (c.parity > 0 && !readable) {
+		return c.wrapBuffered(in, out)
 	}
 
-	_, err = tmp.Seek(0, 0)
+	sl, err := wrapTable(in, ws, c.algo, bits, chunk, c.parity, c.meta)
 	if err != nil {
 		return nil, err
 	}
+	if c.parity > 0 {
+		err = writeParity(rws, sl, a)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sl, nil
+}
 
-	outwr := bufio.NewWriter(out)
-	_, err = outwr.ReadFrom(tmp)
+// Writes the seal in a single pass with the trailer layout.
+func (c *wrapConfig) wrapStream(in io.Reader, out io.Writer, sigLen int) (*Seal, error) {
+	w, err := NewWriterWith(out, c.algo, sigLen*8)
 	if err != nil {
-		return sl, err
+		return nil, err
 	}
 
-	return sl, outwr.Flush()
+	buf := getBuffer(c.bufSize)
+	defer putBuffer(buf)
+	_, err = io.CopyBuffer(w, in, buf)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w.Seal, nil
 }
 
-func Unwrap(in io.Reader, out io.Writer) (*UnwrappedSeal, error) {
-
-	bufIn := bufio.NewReader(in)
-
-	s, err := parseHeader(bufIn)
+// Wraps to a temporary file, which can seek, and then copies it to `out`.
+func (c *wrapConfig) wrapBuffered(in io.Reader, out io.Writer) (*Seal, error) {
+	tmp, err := ioutil.TempFile("", "seal")
 	if err != nil {
 		return nil, err
 	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
 
-	sl := &UnwrappedSeal{Seal: *s}
-
-	calcSig, err := teesum(bufIn, out)
+	// Do the actual wrapping, but output to a temporary file.
+	sl, err := c.wrap(in, tmp)
 	if err != nil {
 		return sl, err
 	}
 
-	sl.CalculatedSignature = calcSig[:len(sl.ClaimedSignature)]
-
-	if !bytes.Equal(sl.ClaimedSignature, sl.CalculatedSignature) {
-		err = ErrSealBroken
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
 	}
 
+	buf := getBuffer(c.bufSize)
+	defer putBuffer(buf)
+	_, err = io.CopyBuffer(out, tmp, buf)
 	return sl, err
 }
 
-// Dump the raw seal header.
+// Deprecated: Use Wrap with WithBits.
+func WrapBits(in io.Reader, out io.WriteSeeker, bits int) (*Seal, error) {
+	return Wrap(in, out, WithBits(bits))
+}
+
+// Same as WrapBits, but hashes with the named algorithm.
+//
+// Deprecated: Use Wrap with WithAlgorithm and WithBits.
+func WrapWith(in io.Reader, out io.WriteSeeker, algo string, bits int) (*Seal, error) {
+	return Wrap(in, out, WithAlgorithm(algo), WithBits(bits))
+}
+
+// Same as Wrap, but uses a temporary file to buffer the output because
+// `out` is not seekable.
+//
+// Deprecated: Use Wrap, which streams to writers that can't seek.
+func WrapBuffered(in io.Reader, out io.Writer) (*Seal, error) {
+	return WrapBufferedBits(in, out, DefaultSealBits)
+}
+
+// Deprecated: Use Wrap with WithBits, which streams to writers that can't
+// seek.
+func WrapBufferedBits(in io.Reader, out io.Writer, bits int) (*Seal, error) {
+	return WrapBufferedWith(in, out, DefaultVariant, bits)
+}
+
+// Same as WrapWith, but buffers through a temporary file like WrapBuffered.
+//
+// Deprecated: Use Wrap with WithAlgorithm and WithBits, which streams to
+// writers that can't seek.
+func WrapBufferedWith(in io.Reader, out io.Writer, algo string, bits int) (*Seal, error) {
+	return newWrapConfig([]Option{WithAlgorithm(algo), WithBits(bits)}).wrapBuffered(in, out)
+}
+
+// Unwrap the sealed file from `in`, writing its content to `out`. Content is
+// written before the claim is checked, so `out` may hold corrupt data when
+// ErrSealBroken is returned.
+func Unwrap(in io.Reader, out io.Writer) (*UnwrappedSeal, error) {
+	r, err := NewReader(in)
+	if err != nil {
+		return nil, err
+	}
+
+	return unwrapReader(r, out)
+}
+
+// Reads the content on this goroutine while others write and verify it.
+func unwrapReader(r *Reader, out io.Writer) (*UnwrappedSeal, error) {
+	_, err := r.WriteTo(out)
+	return &r.UnwrappedSeal, err
+}
+
+// Dump the raw seal header. Nothing is written if the header doesn't end
+// within MaxHeaderLen bytes.
 func DumpHeader(in io.Reader, out io.Writer) error {
-	// TODO: Make this safer. Search for `}\n` or `}\r\n`
-	line, err := bufio.NewReader(in).ReadSlice('\n')
+	line, err := readHeaderLine(bufio.NewReader(in))
 	if err != nil {
 		return err
 	}
@@ -162,23 +375,17 @@ func DumpHeader(in io.Reader, out io.Writer) error {
 	return err
 }
 
-func bitsToBytes(bits int) int {
+func bitsToBytes(bits, max int) int {
 	bytes := bits / 8
-	if bits <= 0 || bytes*8 != bits || bytes > maxBytes {
+	if bits <= 0 || bytes*8 != bits || bytes > max {
 		return -1
 	}
 	return bytes
 }
 
-// Take the hash of the data from in, write it to out, and return the hash.
-func teesum(in io.Reader, out io.Writer) ([]byte, error) {
-	digester := sha512.New()
-
-	tee := bufio.NewReader(io.TeeReader(in, out))
-	_, err := tee.WriteTo(digester)
-	if err != nil {
-		return nil, err
-	}
-
-	return digester.Sum(nil), nil
+// Copy the data from in to out through buffers of bufSize bytes, hashing it
+// with digester, and return the number of bytes copied. Reading, writing and
+// hashing happen concurrently.
+func teesum(in io.Reader, out io.Writer, digester hash.Hash, bufSize int) (int64, error) {
+	return pipeline(in, bufSize, out, digester)
 }
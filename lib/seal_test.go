@@ -1,8 +1,13 @@
 package seal
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -118,6 +123,179 @@ func TestUnwrapGood(t *testing.T) {
 }
 
 func TestUnwrapBad(t *testing.T) {
-	// TODO: wrong magic number, etc.
-	t.Fatal("Not implemented")
+	c := goodCases[1]
+	cases := []struct {
+		file string
+		err  error
+	}{
+		{"", ErrMalformedHeader},
+		{strings.Replace(c.header, "SL%v", "SL%x", 1) + c.data, ErrBadMagic},
+		{strings.Replace(c.header, "SL%v0", "SL%v1", 1) + c.data, ErrUnsupportedVersion},
+		{strings.Replace(c.header, "}", "0}", 1) + c.data, ErrMalformedClaim},
+		{c.header + "seal?\n", ErrSealBroken},
+		{strings.Replace(c.header, "{0d", "{0e", 1) + c.data, ErrSealBroken},
+		{c.header, ErrSealBroken},
+	}
+
+	for _, c := range cases {
+		_, err := Unwrap(strings.NewReader(c.file), ioutil.Discard)
+		assert.True(t, errors.Is(err, c.err), "%q: %v", c.file, err)
+	}
+}
+
+func TestParseHeaderVariants(t *testing.T) {
+	cases := []struct {
+		header string
+		seal   *Seal
+	}{
+		{
+			header: "SL%v0{cf83e135}\n",
+			seal: &Seal{
+				Magic:            `SL%v`,
+				Version:          0,
+				ClaimedSignature: decodeHex(`cf83e135`),
+			},
+		}, {
+			header: "SL%v0{sha512:cf83e135}\n",
+			seal: &Seal{
+				Magic:            `SL%v`,
+				Version:          0,
+				Variant:          VariantSHA512,
+				ClaimedSignature: decodeHex(`cf83e135`),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		sl, err := parseHeader(bufio.NewReader(strings.NewReader(c.header)))
+		require.Nil(t, err)
+
+		assert.Equal(t, c.seal, sl)
+		assert.Equal(t, DefaultVariant, sl.VariantName())
+		assert.Equal(t, c.header, sl.String())
+	}
+}
+
+func TestParseHeaderVariantsBad(t *testing.T) {
+	_, err := parseHeader(bufio.NewReader(strings.NewReader("SL%v0{md5:cf83e135}\n")))
+	assert.True(t, errors.Is(err, ErrUnknownVariant))
+
+	_, err = parseHeader(bufio.NewReader(strings.NewReader("SL%v0{:cf83e135}\n")))
+	assert.True(t, errors.Is(err, ErrUnknownVariant))
+
+	_, err = parseHeader(bufio.NewReader(strings.NewReader("SL%v0{sha512:xyz}\n")))
+	assert.NotNil(t, err)
+
+	long := "SL%v0{" + strings.Repeat("00", maxBytes+1) + "}\n"
+	_, err = parseHeader(bufio.NewReader(strings.NewReader(long)))
+	assert.True(t, errors.Is(err, ErrBadSignatureLength))
+	assert.True(t, errors.Is(err, ErrMalformedHeader))
+}
+
+func TestParseHeaderBad(t *testing.T) {
+	claim := strings.Repeat("00", 32)
+	cases := []struct {
+		header string
+		err    error
+	}{
+		{"", errNoHeader},
+		{"SL%v0{" + claim + "}", errNoHeader},
+		{"SL\n", ErrBadMagic},
+		{"SL%x0{" + claim + "}\n", ErrBadMagic},
+		{"SL%v\n", ErrUnsupportedVersion},
+		{"SL%vx{" + claim + "}\n", ErrUnsupportedVersion},
+		{"SL%v1{" + claim + "}\n", ErrUnsupportedVersion},
+		{"SL%v0\n", ErrMalformedClaim},
+		{"SL%v0{}\n", ErrMalformedClaim},
+		{"SL%v0{" + claim + "\n", ErrMalformedClaim},
+		{"SL%v0" + claim + "}\n", ErrMalformedClaim},
+		{"SL%v0{{" + claim + "}\n", ErrMalformedClaim},
+		{"SL%v0{sha256: " + claim + "}\n", ErrMalformedClaim},
+		{"SL%v0{" + claim + "0}\n", ErrMalformedClaim},
+		{"SL%v0{sha256:~x}\n", ErrMalformedClaim},
+		{"SL%v0{" + strings.Repeat("0", MaxHeaderLen) + "}\n", ErrHeaderTooLong},
+	}
+
+	for _, c := range cases {
+		_, err := parseHeader(bufio.NewReader(strings.NewReader(c.header)))
+		assert.True(t, errors.Is(err, c.err), "%q: %v", c.header, err)
+		assert.True(t, errors.Is(err, ErrMalformedHeader), "%q: %v", c.header, err)
+	}
+}
+
+func TestParseHeaderCRLF(t *testing.T) {
+	for _, c := range goodCases {
+		header := strings.TrimSuffix(c.header, "\n") + "\r\n"
+		sl, err := parseHeader(bufio.NewReader(strings.NewReader(header)))
+		require.Nil(t, err)
+		assert.Equal(t, c.seal, sl)
+
+		usl, err := Unwrap(strings.NewReader(header+c.data), ioutil.Discard)
+		require.Nil(t, err)
+		assert.Equal(t, *c.seal, usl.Seal)
+	}
+}
+
+func TestParseHeaderBounded(t *testing.T) {
+	// Nothing past the limit is read from a file without a header line.
+	r := &countingReader{r: strings.NewReader(strings.Repeat("x", 1<<20))}
+	_, err := NewReader(r)
+	assert.True(t, errors.Is(err, ErrHeaderTooLong))
+	assert.True(t, r.n <= MaxHeaderLen+4096, "read %d bytes", r.n)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += n
+	return n, err
+}
+
+func TestWrapWithAlgorithms(t *testing.T) {
+	cases := []struct {
+		algo, header string
+	}{
+		{VariantSHA512, "SL%v0{0d406d27279f9e9ff7dd349f49069c5dba677e013e5b5c9c1d857f9e560155bf}\n"},
+		{VariantSHA256, "SL%v0{sha256:da13cda74a35640298d70bf3286a020e26e4b526f63bf8f9b05fc5a490900d4a}\n"},
+		{VariantSHA3, ""},
+		{VariantBLAKE2b, ""},
+		{VariantBLAKE3, ""},
+	}
+
+	for _, c := range cases {
+		algo, err := LookupAlgorithm(c.algo)
+		require.Nil(t, err)
+
+		h := algo.New()
+		h.Write([]byte("seal!\n"))
+		sum := h.Sum(nil)
+
+		wrapped := &bytes.Buffer{}
+		sl, err := WrapBufferedWith(bytes.NewBufferString("seal!\n"), wrapped, c.algo, 256)
+		require.Nil(t, err)
+		assert.Equal(t, sum[:32], sl.ClaimedSignature)
+		assert.Equal(t, c.algo, sl.VariantName())
+		if c.header != "" {
+			assert.Equal(t, c.header, sl.String())
+		}
+		assert.Equal(t, sl.String()+"seal!\n", wrapped.String())
+
+		unwrapped := &bytes.Buffer{}
+		usl, err := Unwrap(wrapped, unwrapped)
+		require.Nil(t, err)
+		assert.Equal(t, sl, &usl.Seal)
+		assert.Equal(t, "seal!\n", unwrapped.String())
+	}
+}
+
+func TestWrapWithBad(t *testing.T) {
+	_, err := WrapBufferedWith(bytes.NewBufferString("seal!\n"), &bytes.Buffer{}, "md5", 128)
+	assert.True(t, errors.Is(err, ErrUnknownAlgorithm))
+
+	_, err = WrapBufferedWith(bytes.NewBufferString("seal!\n"), &bytes.Buffer{}, VariantBLAKE3, 512)
+	assert.Equal(t, ErrBadSignatureLength, err)
 }
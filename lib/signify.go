@@ -0,0 +1,263 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The signify variant. The claim is a base64-encoded signify signature of
+// the sealed content.
+const VariantSignify = "signify"
+
+// Key and signature formats used by OpenBSD's signify(1). All structures are
+// stored base64-encoded on the line following an untrusted comment.
+const (
+	signifyPKAlg       = "Ed"
+	signifyKDFAlg      = "BK"
+	signifyComment     = "untrusted comment: "
+	signifyKeyNumLen   = 8
+	signifySaltLen     = 16
+	signifyChecksumLen = 8
+
+	// pkalg + keynum + pubkey
+	signifyPublicKeyLen = 2 + signifyKeyNumLen + ed25519.PublicKeySize
+	// pkalg + kdfalg + kdfrounds + salt + checksum + keynum + seckey
+	signifySecretKeyLen = 2 + 2 + 4 + signifySaltLen + signifyChecksumLen +
+		signifyKeyNumLen + ed25519.PrivateKeySize
+	// pkalg + keynum + sig
+	signifySignatureLen = 2 + signifyKeyNumLen + ed25519.SignatureSize
+)
+
+var ErrPublicKeyRequired = errors.New("seal: public key required to verify signify seal")
+var ErrNotSigned = errors.New("seal: seal is not signed")
+var ErrWrongKey = errors.New("seal: signature was made with a different key")
+var ErrPassphraseRequired = errors.New("seal: secret key is encrypted")
+var ErrBadPassphrase = errors.New("seal: incorrect passphrase")
+
+func init() {
+	RegisterVariant(&Variant{
+		Name:          VariantSignify,
+		EncodeClaim:   base64.StdEncoding.EncodeToString,
+		DecodeClaim:   base64.StdEncoding.DecodeString,
+		ValidClaimLen: func(n int) bool { return n == signifySignatureLen },
+	})
+}
+
+// PublicKey is a signify public key.
+type PublicKey struct {
+	KeyNum [signifyKeyNumLen]byte
+	Key    ed25519.PublicKey
+}
+
+// SecretKey is a decrypted signify secret key.
+type SecretKey struct {
+	KeyNum [signifyKeyNumLen]byte
+	Key    ed25519.PrivateKey
+}
+
+// Generates a new signify key pair using entropy from rand.
+func GenerateKey(rand io.Reader) (*PublicKey, *SecretKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sk := &SecretKey{Key: priv}
+	_, err = io.ReadFull(rand, sk.KeyNum[:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &PublicKey{KeyNum: sk.KeyNum, Key: pub}, sk, nil
+}
+
+// Parses the contents of a signify public key file.
+func ParsePublicKey(file []byte) (*PublicKey, error) {
+	_, blob, err := parseSignifyFile(file, signifyPublicKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	pk := &PublicKey{Key: make(ed25519.PublicKey, ed25519.PublicKeySize)}
+	copy(pk.KeyNum[:], blob[2:])
+	copy(pk.Key, blob[2+signifyKeyNumLen:])
+	return pk, nil
+}
+
+// Parses the contents of a signify secret key file. If the key is
+// encrypted and passphrase is empty, ErrPassphraseRequired is returned.
+func ParseSecretKey(file, passphrase []byte) (*SecretKey, error) {
+	_, blob, err := parseSignifyFile(file, signifySecretKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(blob[2:4]) != signifyKDFAlg {
+		return nil, fmt.Errorf("seal: unsupported kdf algorithm: %q", blob[2:4])
+	}
+	rounds := binary.BigEndian.Uint32(blob[4:])
+	salt := blob[8 : 8+signifySaltLen]
+	checksum := blob[8+signifySaltLen : 8+signifySaltLen+signifyChecksumLen]
+	keynum := blob[8+signifySaltLen+signifyChecksumLen:][:signifyKeyNumLen]
+	enc := blob[signifySecretKeyLen-ed25519.PrivateKeySize:]
+
+	sk := &SecretKey{Key: make(ed25519.PrivateKey, ed25519.PrivateKeySize)}
+	copy(sk.KeyNum[:], keynum)
+	copy(sk.Key, enc)
+
+	if rounds > 0 {
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		xorkey, err := bcryptPBKDF(passphrase, salt, int(rounds), len(sk.Key))
+		if err != nil {
+			return nil, err
+		}
+		for i := range sk.Key {
+			sk.Key[i] ^= xorkey[i]
+		}
+	}
+
+	sum := sha512.Sum512(sk.Key)
+	if subtle.ConstantTimeCompare(sum[:signifyChecksumLen], checksum) != 1 {
+		if rounds > 0 {
+			return nil, ErrBadPassphrase
+		}
+		return nil, errors.New("seal: secret key checksum mismatch")
+	}
+
+	return sk, nil
+}
+
+// Returns the public half of the key pair.
+func (sk *SecretKey) Public() *PublicKey {
+	return &PublicKey{
+		KeyNum: sk.KeyNum,
+		Key:    sk.Key.Public().(ed25519.PublicKey),
+	}
+}
+
+// Signs msg, returning a signify signature.
+func (sk *SecretKey) Sign(msg []byte) []byte {
+	sig := make([]byte, 0, signifySignatureLen)
+	sig = append(sig, signifyPKAlg...)
+	sig = append(sig, sk.KeyNum[:]...)
+	return append(sig, ed25519.Sign(sk.Key, msg)...)
+}
+
+// Encodes the key in the unencrypted signify secret key file format, as
+// produced by `signify -G -n`.
+func (sk *SecretKey) Marshal(comment string) []byte {
+	blob := make([]byte, 0, signifySecretKeyLen)
+	blob = append(blob, signifyPKAlg...)
+	blob = append(blob, signifyKDFAlg...)
+	blob = append(blob, 0, 0, 0, 0) // kdfrounds
+	blob = append(blob, make([]byte, signifySaltLen)...)
+	sum := sha512.Sum512(sk.Key)
+	blob = append(blob, sum[:signifyChecksumLen]...)
+	blob = append(blob, sk.KeyNum[:]...)
+	blob = append(blob, sk.Key...)
+	return marshalSignifyFile(comment, blob)
+}
+
+// Encodes the key in the signify public key file format.
+func (pk *PublicKey) Marshal(comment string) []byte {
+	blob := make([]byte, 0, signifyPublicKeyLen)
+	blob = append(blob, signifyPKAlg...)
+	blob = append(blob, pk.KeyNum[:]...)
+	blob = append(blob, pk.Key...)
+	return marshalSignifyFile(comment, blob)
+}
+
+// Verifies a signify signature of msg.
+func (pk *PublicKey) Verify(msg, sig []byte) error {
+	if len(sig) != signifySignatureLen || string(sig[:2]) != signifyPKAlg {
+		return ErrBadSignatureLength
+	}
+	if !bytes.Equal(sig[2:2+signifyKeyNumLen], pk.KeyNum[:]) {
+		return ErrWrongKey
+	}
+	if !ed25519.Verify(pk.Key, msg, sig[2+signifyKeyNumLen:]) {
+		return ErrSealBroken
+	}
+	return nil
+}
+
+// Reads a signify file: an untrusted comment line followed by a line of
+// base64. The decoded data must be exactly size bytes and start with the
+// Ed25519 algorithm identifier.
+func parseSignifyFile(file []byte, size int) (comment string, blob []byte, err error) {
+	lines := strings.SplitN(string(file), "\n", 3)
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], signifyComment) {
+		return "", nil, errors.New("seal: invalid signify file: missing untrusted comment")
+	}
+	comment = strings.TrimPrefix(lines[0], signifyComment)
+
+	blob, err = base64.StdEncoding.DecodeString(strings.TrimRight(lines[1], "\r"))
+	if err != nil {
+		return "", nil, fmt.Errorf("seal: invalid signify file: %v", err)
+	}
+	if len(blob) != size {
+		return "", nil, errors.New("seal: invalid signify file: wrong length")
+	}
+	if string(blob[:2]) != signifyPKAlg {
+		return "", nil, fmt.Errorf("seal: unsupported signature algorithm: %q", blob[:2])
+	}
+
+	return comment, blob, nil
+}
+
+func marshalSignifyFile(comment string, blob []byte) []byte {
+	return []byte(signifyComment + comment + "\n" +
+		base64.StdEncoding.EncodeToString(blob) + "\n")
+}
+
+// Wrap the contents of `in` with a signify seal, signed by key. Signify
+// signs the whole message at once, so the content is held in memory.
+//
+// Deprecated: Use Wrap with WithSigner.
+func WrapSignify(in io.Reader, out io.Writer, key *SecretKey) (*Seal, error) {
+	return Wrap(in, out, WithSigner(key))
+}
+
+func wrapSignify(in io.Reader, out io.Writer, key *SecretKey) (*Seal, error) {
+	content, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+
+	sl := &Seal{
+		Magic:            Magic,
+		Version:          Version,
+		Variant:          VariantSignify,
+		ClaimedSignature: key.Sign(content),
+	}
+
+	outwr := bufio.NewWriter(out)
+	outwr.Write(sl.Bytes())
+	outwr.Write(content)
+	return sl, outwr.Flush()
+}
+
+// Unwrap a signify seal, verifying the signature with key. Like Unwrap,
+// content is written to `out` before the signature is checked.
+func UnwrapSignify(in io.Reader, out io.Writer, key *PublicKey) (*UnwrappedSeal, error) {
+	r, err := NewSignifyReader(in, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return unwrapReader(r, out)
+}
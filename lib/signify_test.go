@@ -0,0 +1,118 @@
+package seal
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 8032, section 7.1, test 1.
+var rfc8032Seed = decodeHex(`9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60`)
+var rfc8032Sig = decodeHex(`e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b`)
+
+func testSecretKey() *SecretKey {
+	return &SecretKey{
+		KeyNum: [8]byte{1, 2, 3, 4, 5, 6, 7, 8},
+		Key:    ed25519.NewKeyFromSeed(rfc8032Seed),
+	}
+}
+
+func TestBcryptPBKDF(t *testing.T) {
+	// Test vector generated by the reference implementation from OpenBSD.
+	key, err := bcryptPBKDF([]byte("password"), []byte("salt"), 12, 32)
+	require.Nil(t, err)
+	assert.Equal(t, decodeHex(`1ae42c05d487bc02f64921a4ebe4ea93bcacfe135fda99974c06b7b01fae149a`), key)
+}
+
+func TestSignifySign(t *testing.T) {
+	sig := testSecretKey().Sign(nil)
+	assert.Equal(t, []byte("Ed"), sig[:2])
+	assert.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, sig[2:10])
+	assert.Equal(t, rfc8032Sig, sig[10:])
+}
+
+func TestSignifyKeyRoundTrip(t *testing.T) {
+	sk := testSecretKey()
+
+	parsedSK, err := ParseSecretKey(sk.Marshal("signify secret key"), nil)
+	require.Nil(t, err)
+	assert.Equal(t, sk, parsedSK)
+
+	parsedPK, err := ParsePublicKey(sk.Public().Marshal("signify public key"))
+	require.Nil(t, err)
+	assert.Equal(t, sk.Public(), parsedPK)
+}
+
+func TestSignifyEncryptedSecretKey(t *testing.T) {
+	sk := testSecretKey()
+	pass := []byte("hunter2")
+	salt := bytes.Repeat([]byte{0x5a}, signifySaltLen)
+
+	xorkey, err := bcryptPBKDF(pass, salt, 4, ed25519.PrivateKeySize)
+	require.Nil(t, err)
+
+	sum := sha512.Sum512(sk.Key)
+	blob := []byte("EdBK\x00\x00\x00\x04")
+	blob = append(blob, salt...)
+	blob = append(blob, sum[:8]...)
+	blob = append(blob, sk.KeyNum[:]...)
+	for i, b := range sk.Key {
+		blob = append(blob, b^xorkey[i])
+	}
+	file := []byte("untrusted comment: signify secret key\n" +
+		base64.StdEncoding.EncodeToString(blob) + "\n")
+
+	_, err = ParseSecretKey(file, nil)
+	assert.Equal(t, ErrPassphraseRequired, err)
+
+	_, err = ParseSecretKey(file, []byte("hunter3"))
+	assert.Equal(t, ErrBadPassphrase, err)
+
+	parsed, err := ParseSecretKey(file, pass)
+	require.Nil(t, err)
+	assert.Equal(t, sk, parsed)
+}
+
+func TestSignifyWrapUnwrap(t *testing.T) {
+	sk := testSecretKey()
+	data := "seal!\n"
+
+	wrapped := &bytes.Buffer{}
+	sl, err := WrapSignify(bytes.NewBufferString(data), wrapped, sk)
+	require.Nil(t, err)
+	assert.Equal(t, VariantSignify, sl.Variant)
+	assert.Equal(t, sl.String()+data, wrapped.String())
+
+	sealed := wrapped.String()
+
+	unwrapped := &bytes.Buffer{}
+	usl, err := UnwrapSignify(bytes.NewBufferString(sealed), unwrapped, sk.Public())
+	require.Nil(t, err)
+	assert.Equal(t, sl, &usl.Seal)
+	assert.Equal(t, data, unwrapped.String())
+
+	_, err = Unwrap(bytes.NewBufferString(sealed), &bytes.Buffer{})
+	assert.Equal(t, ErrPublicKeyRequired, err)
+
+	corrupt := sealed[:len(sealed)-2] + "?\n"
+	_, err = UnwrapSignify(bytes.NewBufferString(corrupt), &bytes.Buffer{}, sk.Public())
+	assert.Equal(t, ErrSealBroken, err)
+
+	other, _, err := GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	_, err = UnwrapSignify(bytes.NewBufferString(sealed), &bytes.Buffer{}, other)
+	assert.Equal(t, ErrWrongKey, err)
+}
+
+func TestSignifyUnwrapNotSigned(t *testing.T) {
+	c := goodCases[1]
+	_, err := UnwrapSignify(bytes.NewBufferString(c.header+c.data),
+		&bytes.Buffer{}, testSecretKey().Public())
+	assert.Equal(t, ErrNotSigned, err)
+}
@@ -0,0 +1,345 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import (
+	"bufio"
+	"errors"
+	"hash"
+	"io"
+	"runtime"
+	"strings"
+)
+
+// Merkle variants hash the content as a tree of fixed-size chunks. The claim
+// is the root of the tree, and the hash of every chunk is stored in a table
+// after the content, so a chunk can be verified without reading the rest.
+// Hash variants may also carry a chunk table, but their claim stays the hash
+// of the whole content, so the table itself is not covered by the claim.
+//
+// Leaves and nodes are hashed as in RFC 6962, with 0x00 and 0x01 prefixes
+// respectively.
+const treePrefix = "merkle-"
+
+// The default size of a chunk in a merkle seal.
+const DefaultChunkSize = 1 << 20
+
+var ErrBadChunkSize = errors.New("seal: chunk size is invalid")
+var ErrBadChunkTable = errors.New("seal: chunk table does not match claim")
+
+var (
+	leafPrefix = []byte{0}
+	nodePrefix = []byte{1}
+)
+
+func isTreeVariant(name string) bool {
+	return strings.HasPrefix(name, treePrefix)
+}
+
+// Returns the algorithm used by a merkle variant, or by a hash variant, for
+// its chunk table.
+func tableAlgorithm(name string) (*Algorithm, error) {
+	return LookupAlgorithm(strings.TrimPrefix(name, treePrefix))
+}
+
+// The claim of a merkle variant is always the full root.
+func treeVariant(name string, size int) *Variant {
+	v := hexVariant(treePrefix+name, size)
+	v.ValidClaimLen = func(n int) bool { return n == size }
+	return v
+}
+
+// Chunks at least this large are hashed concurrently. Smaller ones aren't
+// worth a goroutine each.
+var minParallelChunk int64 = 64 * 1024
+
+// The most memory spent on chunks waiting to be hashed. Chunks too large for
+// two of them to fit are hashed as they're written instead, however large
+// the chunk size in a header is.
+const maxParallelMemory = 64 << 20
+
+// treeHash is a hash.Hash whose sum is the root of a merkle tree over the
+// data written to it.
+//
+// Leaves are hashed on up to GOMAXPROCS cores when chunks are large, but not
+// too large: the open chunk is copied to buf, and once full, it's hashed on
+// its own goroutine, whose sum is collected from pending in order.
+type treeHash struct {
+	algo      *Algorithm
+	chunkSize int64
+
+	leaf   hash.Hash
+	open   bool  // A partial leaf has been written to leaf, or buf.
+	n      int64 // Bytes written to the open leaf.
+	total  int64
+	leaves [][]byte
+
+	workers int // The most chunks hashed at once, or 0 to hash in Write.
+	buf     []byte
+	free    chan []byte
+	pending []chan []byte
+}
+
+func newTreeHash(algo *Algorithm, chunkSize int64) *treeHash {
+	t := &treeHash{algo: algo, chunkSize: chunkSize, leaf: algo.New()}
+	if chunkSize < minParallelChunk {
+		return t
+	}
+
+	n := int64(runtime.GOMAXPROCS(0))
+	if n > maxParallelMemory/chunkSize {
+		n = maxParallelMemory / chunkSize
+	}
+	if n > 1 {
+		t.workers = int(n)
+		t.free = make(chan []byte, n+1)
+	}
+	return t
+}
+
+func (t *treeHash) Write(p []byte) (int, error) {
+	written := len(p)
+	t.total += int64(written)
+
+	for len(p) > 0 {
+		if !t.open {
+			t.openLeaf()
+		}
+
+		m := int64(len(p))
+		if m > t.chunkSize-t.n {
+			m = t.chunkSize - t.n
+		}
+		if t.workers > 0 {
+			copy(t.buf[t.n:], p[:m])
+		} else {
+			t.leaf.Write(p[:m])
+		}
+		t.n += m
+		p = p[m:]
+
+		if t.n == t.chunkSize {
+			t.closeLeaf()
+		}
+	}
+
+	return written, nil
+}
+
+func (t *treeHash) openLeaf() {
+	t.open, t.n = true, 0
+	if t.workers == 0 {
+		t.leaf.Reset()
+		t.leaf.Write(leafPrefix)
+		return
+	}
+
+	select {
+	case t.buf = <-t.free:
+	default:
+		t.buf = make([]byte, t.chunkSize)
+	}
+}
+
+// Hashes the full open leaf, or starts to.
+func (t *treeHash) closeLeaf() {
+	t.open = false
+	if t.workers == 0 {
+		t.leaves = append(t.leaves, t.leaf.Sum(nil))
+		return
+	}
+
+	if len(t.pending) == t.workers {
+		t.collect(1)
+	}
+	sum := make(chan []byte, 1)
+	t.pending = append(t.pending, sum)
+	go func(chunk []byte) {
+		leaf := leafHash(t.algo, chunk)
+		t.free <- chunk
+		sum <- leaf
+	}(t.buf)
+	t.buf = nil
+}
+
+// Waits for the first n pending leaves and appends them to the leaves.
+func (t *treeHash) collect(n int) {
+	for _, sum := range t.pending[:n] {
+		t.leaves = append(t.leaves, <-sum)
+	}
+	t.pending = t.pending[:copy(t.pending, t.pending[n:])]
+}
+
+// Returns the hash of every chunk written so far, including a partial last
+// chunk.
+func (t *treeHash) Leaves() [][]byte {
+	t.collect(len(t.pending))
+	if !t.open {
+		return t.leaves
+	}
+
+	var last []byte
+	if t.workers > 0 {
+		last = leafHash(t.algo, t.buf[:t.n])
+	} else {
+		last = t.leaf.Sum(nil)
+	}
+	return append(t.leaves[:len(t.leaves):len(t.leaves)], last)
+}
+
+func (t *treeHash) Sum(b []byte) []byte {
+	return append(b, merkleRoot(t.algo, t.Leaves())...)
+}
+
+func (t *treeHash) Reset() {
+	t.collect(len(t.pending))
+	if t.buf != nil {
+		t.free <- t.buf
+		t.buf = nil
+	}
+	t.open, t.n, t.total, t.leaves = false, 0, 0, nil
+}
+
+func (t *treeHash) Size() int      { return t.algo.MaxBytes }
+func (t *treeHash) BlockSize() int { return t.leaf.BlockSize() }
+
+func leafHash(algo *Algorithm, chunk []byte) []byte {
+	h := algo.New()
+	h.Write(leafPrefix)
+	h.Write(chunk)
+	return h.Sum(nil)
+}
+
+// Returns the root of the tree with the given leaves. The left subtree holds
+// the largest power of two leaves smaller than the total.
+func merkleRoot(algo *Algorithm, leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		return algo.New().Sum(nil)
+	case 1:
+		return leaves[0]
+	}
+
+	k := 1
+	for k*2 < len(leaves) {
+		k *= 2
+	}
+
+	h := algo.New()
+	h.Write(nodePrefix)
+	h.Write(merkleRoot(algo, leaves[:k]))
+	h.Write(merkleRoot(algo, leaves[k:]))
+	return h.Sum(nil)
+}
+
+// Returns the number of chunks and the size of the chunk table of a seal.
+func chunkTable(sl *Seal, algo *Algorithm) (chunks, size int64) {
+	chunks = (sl.Length + sl.ChunkSize - 1) / sl.ChunkSize
+	return chunks, chunks * int64(algo.MaxBytes)
+}
+
+// Wrap the contents of `in` with a merkle seal, hashing chunks of chunkSize
+// bytes with the named algorithm. The chunk table is kept in memory until
+// the content has been written.
+//
+// Deprecated: Use Wrap with WithAlgorithm of the merkle variant, and
+// WithChunk.
+func WrapMerkle(in io.Reader, out io.WriteSeeker, algo string, chunkSize int64) (*Seal, error) {
+	return Wrap(in, out, WithAlgorithm(treePrefix+algo), WithChunk(chunkSize))
+}
+
+// Same as WrapWith, but also stores a table of the hashes of chunkSize byte
+// chunks after the content, so corruption can be located.
+//
+// Deprecated: Use Wrap with WithAlgorithm, WithBits and WithChunk.
+func WrapChunked(in io.Reader, out io.WriteSeeker, algo string, bits int, chunkSize int64) (*Seal, error) {
+	return Wrap(in, out, WithAlgorithm(algo), WithBits(bits), WithChunk(chunkSize))
+}
+
+// Seals `in` with a chunk table, using either a hash or a merkle variant.
+// bits is ignored for merkle variants, whose claim is always the full root.
+// meta may be nil, and must be for merkle variants.
+func wrapTable(in io.Reader, out io.WriteSeeker, variant string, bits int, chunkSize int64, parity int, meta *Metadata) (*Seal, error) {
+	a, err := tableAlgorithm(variant)
+	if err != nil {
+		return nil, err
+	}
+
+	sl := &Seal{
+		Magic:    Magic,
+		Version:  Version,
+		Parity:   parity,
+		Metadata: meta,
+	}
+
+	th := newTreeHash(a, chunkSize)
+	var h hash.Hash = th
+	if isTreeVariant(variant) {
+		sl.Variant = variant
+		sl.ClaimedSignature = make([]byte, a.MaxBytes)
+	} else {
+		sigLen := bitsToBytes(bits, a.MaxBytes)
+		if sigLen == -1 {
+			return nil, ErrBadSignatureLength
+		}
+		sl.ClaimedSignature = make([]byte, sigLen)
+		if variant != DefaultVariant {
+			sl.Variant = variant
+		}
+		h = a.New()
+	}
+
+	err = wrapChunks(in, out, sl, h, th)
+	if err != nil {
+		return nil, err
+	}
+	return sl, nil
+}
+
+// Writes the content of `in` and its chunk table to `out`, then seeks back
+// to write the header of sl. The claim is the sum of h truncated to the
+// length of the placeholder claim in sl. h may be th itself.
+func wrapChunks(in io.Reader, out io.WriteSeeker, sl *Seal, h hash.Hash, th *treeHash) error {
+	if th.chunkSize <= 0 || th.chunkSize > MaxChunkSize {
+		return ErrBadChunkSize
+	}
+	sl.ChunkSize = th.chunkSize
+
+	_, err := out.Seek(int64(len(sl.String())), 0)
+	if err != nil {
+		return err
+	}
+
+	digesters := []io.Writer{out, th}
+	if h != hash.Hash(th) {
+		digesters = append(digesters, h)
+	}
+
+	_, err = pipeline(in, defaultBufferSize, digesters...)
+	if err != nil {
+		return err
+	}
+
+	sl.Length = th.total
+	if h != hash.Hash(th) {
+		h.Write(sl.coveredAttributes())
+	}
+	sl.ClaimedSignature = h.Sum(nil)[:len(sl.ClaimedSignature)]
+
+	outwr := bufio.NewWriter(out)
+	for _, leaf := range th.Leaves() {
+		outwr.Write(leaf)
+	}
+	err = outwr.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Seek(0, 0)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(sl.Bytes())
+	return err
+}
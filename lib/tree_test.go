@@ -0,0 +1,299 @@
+package seal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const treeData = "0123456789abcdefghij"
+
+// Seals treeData in 4 byte chunks, returning the sealed file.
+func wrapMerkleTemp(t *testing.T) (*os.File, *Seal) {
+	f, err := ioutil.TempFile("", "seal")
+	require.Nil(t, err)
+	os.Remove(f.Name())
+
+	sl, err := WrapMerkle(bytes.NewBufferString(treeData), f, VariantSHA256, 4)
+	require.Nil(t, err)
+	return f, sl
+}
+
+func TestMerkleRoot(t *testing.T) {
+	algo, err := LookupAlgorithm(VariantSHA256)
+	require.Nil(t, err)
+
+	node := func(l, r []byte) []byte {
+		h := algo.New()
+		h.Write([]byte{1})
+		h.Write(l)
+		h.Write(r)
+		return h.Sum(nil)
+	}
+
+	a, b, c := leafHash(algo, []byte("a")), leafHash(algo, []byte("b")), leafHash(algo, []byte("c"))
+	assert.Equal(t, algo.New().Sum(nil), merkleRoot(algo, nil))
+	assert.Equal(t, a, merkleRoot(algo, [][]byte{a}))
+	assert.Equal(t, node(node(a, b), c), merkleRoot(algo, [][]byte{a, b, c}))
+
+	th := newTreeHash(algo, 1)
+	th.Write([]byte("ab"))
+	th.Write([]byte("c"))
+	assert.Equal(t, node(node(a, b), c), th.Sum(nil))
+}
+
+func TestTreeHashParallel(t *testing.T) {
+	algo, err := LookupAlgorithm(VariantSHA256)
+	require.Nil(t, err)
+
+	defer func(n int64) { minParallelChunk = n }(minParallelChunk)
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	data := []byte(strings.Repeat(treeData, 50))
+	for _, size := range []int64{1, 3, 4, 64, 999, 1000, 1001} {
+		minParallelChunk = size + 1
+		serial := newTreeHash(algo, size)
+		minParallelChunk = size
+		parallel := newTreeHash(algo, size)
+		require.Equal(t, 0, serial.workers)
+		require.Equal(t, 4, parallel.workers)
+
+		// Writes of every size split chunks in every way.
+		for i, n := 0, 1; i < len(data); i, n = i+n, n+1 {
+			end := i + n
+			if end > len(data) {
+				end = len(data)
+			}
+			serial.Write(data[i:end])
+			parallel.Write(data[i:end])
+			if n == 7 {
+				assert.Equal(t, serial.Leaves(), parallel.Leaves(), "chunk %d", size)
+			}
+		}
+		assert.Equal(t, serial.Leaves(), parallel.Leaves(), "chunk %d", size)
+		assert.Equal(t, serial.Sum(nil), parallel.Sum(nil), "chunk %d", size)
+
+		parallel.Reset()
+		parallel.Write(data)
+		assert.Equal(t, serial.Sum(nil), parallel.Sum(nil), "chunk %d", size)
+	}
+
+	// Chunks too large to buffer several of are hashed as they're written.
+	assert.Equal(t, 2, newTreeHash(algo, maxParallelMemory/2).workers)
+	assert.Equal(t, 0, newTreeHash(algo, maxParallelMemory/2+1).workers)
+	assert.Equal(t, 0, newTreeHash(algo, MaxChunkSize).workers)
+}
+
+func TestWrapMerkle(t *testing.T) {
+	f, sl := wrapMerkleTemp(t)
+	defer f.Close()
+
+	assert.Equal(t, VariantSHA256, sl.Variant[len(treePrefix):])
+	assert.Equal(t, int64(4), sl.ChunkSize)
+	assert.Equal(t, int64(len(treeData)), sl.Length)
+
+	_, err := f.Seek(0, 0)
+	require.Nil(t, err)
+	sealed, err := ioutil.ReadAll(f)
+	require.Nil(t, err)
+	assert.Equal(t, sl.String()+treeData, string(sealed[:len(sl.String())+len(treeData)]))
+	assert.Len(t, sealed, len(sl.String())+len(treeData)+5*32)
+
+	unwrapped := &bytes.Buffer{}
+	usl, err := Unwrap(bytes.NewReader(sealed), unwrapped)
+	require.Nil(t, err)
+	assert.Equal(t, sl, &usl.Seal)
+	assert.Equal(t, treeData, unwrapped.String())
+
+	_, err = Unwrap(bytes.NewReader(sealed[:len(sealed)-1]), ioutil.Discard)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestReaderAt(t *testing.T) {
+	f, sl := wrapMerkleTemp(t)
+	defer f.Close()
+
+	info, err := f.Stat()
+	require.Nil(t, err)
+
+	ra, err := NewReaderAt(f, info.Size())
+	require.Nil(t, err)
+	assert.Equal(t, *sl, ra.Seal)
+	assert.Equal(t, int64(len(treeData)), ra.Size())
+
+	p := make([]byte, 7)
+	n, err := ra.ReadAt(p, 3)
+	require.Nil(t, err)
+	assert.Equal(t, treeData[3:10], string(p[:n]))
+
+	n, err = ra.ReadAt(p, 15)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, treeData[15:], string(p[:n]))
+
+	assert.Nil(t, ra.Check())
+
+	// Corrupt the third and fourth chunks.
+	offset := int64(len(sl.String()))
+	_, err = f.WriteAt([]byte("X"), offset+9)
+	require.Nil(t, err)
+	_, err = f.WriteAt([]byte("X"), offset+13)
+	require.Nil(t, err)
+
+	n, err = ra.ReadAt(p, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, treeData[:7], string(p[:n]))
+
+	n, err = ra.ReadAt(p, 5)
+	assert.Equal(t, &CorruptionError{Ranges: []Range{{Offset: 8, Length: 4}}}, err)
+	assert.True(t, errors.Is(err, ErrSealBroken))
+	assert.Equal(t, treeData[5:8], string(p[:n]))
+
+	n, err = ra.ReadAt(p[:4], 16)
+	assert.Nil(t, err)
+	assert.Equal(t, treeData[16:], string(p[:n]))
+
+	err = ra.Check()
+	assert.Equal(t, &CorruptionError{Ranges: []Range{{Offset: 8, Length: 8}}}, err)
+	assert.Equal(t, "seal: claim did not validate against content: corrupt bytes 8-15", err.Error())
+
+	_, err = f.Seek(0, 0)
+	require.Nil(t, err)
+	_, err = Unwrap(f, ioutil.Discard)
+	assert.Equal(t, &CorruptionError{Ranges: []Range{{Offset: 8, Length: 8}}}, err)
+}
+
+// Memory for chunks is limited by the content, not the declared chunk size.
+func TestReaderAtLargeChunk(t *testing.T) {
+	f, err := ioutil.TempFile("", "seal")
+	require.Nil(t, err)
+	os.Remove(f.Name())
+	defer f.Close()
+
+	_, err = WrapMerkle(strings.NewReader(treeData), f, VariantSHA256, MaxChunkSize)
+	require.Nil(t, err)
+	info, err := f.Stat()
+	require.Nil(t, err)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	ra, err := NewReaderAt(f, info.Size())
+	require.Nil(t, err)
+	p := make([]byte, 7)
+	n, err := ra.ReadAt(p, 3)
+	require.Nil(t, err)
+	assert.Equal(t, treeData[3:10], string(p[:n]))
+	assert.Nil(t, ra.Check())
+	runtime.ReadMemStats(&after)
+	assert.True(t, after.TotalAlloc-before.TotalAlloc < 1<<20, "allocated %d bytes", after.TotalAlloc-before.TotalAlloc)
+}
+
+func TestWrapChunked(t *testing.T) {
+	f, err := ioutil.TempFile("", "seal")
+	require.Nil(t, err)
+	os.Remove(f.Name())
+	defer f.Close()
+
+	sl, err := WrapChunked(bytes.NewBufferString(treeData), f, VariantSHA256, 128, 8)
+	require.Nil(t, err)
+	assert.Equal(t, VariantSHA256, sl.Variant)
+	assert.Len(t, sl.ClaimedSignature, 16)
+	assert.Equal(t, int64(8), sl.ChunkSize)
+	assert.Equal(t, int64(len(treeData)), sl.Length)
+
+	info, err := f.Stat()
+	require.Nil(t, err)
+	assert.Equal(t, int64(len(sl.String())+len(treeData)+3*32), info.Size())
+
+	_, err = f.Seek(0, 0)
+	require.Nil(t, err)
+	unwrapped := &bytes.Buffer{}
+	usl, err := Unwrap(f, unwrapped)
+	require.Nil(t, err)
+	assert.Equal(t, sl, &usl.Seal)
+	assert.Equal(t, treeData, unwrapped.String())
+
+	ra, err := NewReaderAt(f, info.Size())
+	require.Nil(t, err)
+	assert.Nil(t, ra.Check())
+
+	// A corrupt table is not covered by the claim, so only the claim decides.
+	_, err = f.WriteAt([]byte("X"), info.Size()-1)
+	require.Nil(t, err)
+	ra, err = NewReaderAt(f, info.Size())
+	require.Nil(t, err)
+	assert.Nil(t, ra.Check())
+
+	_, err = f.WriteAt([]byte("X"), int64(len(sl.String()))+1)
+	require.Nil(t, err)
+	err = ra.Check()
+	assert.Equal(t, &CorruptionError{Ranges: []Range{{Offset: 0, Length: 8}, {Offset: 16, Length: 4}}}, err)
+}
+
+func TestReaderAtNotChunked(t *testing.T) {
+	c := goodCases[1]
+	sealed := []byte(c.header + c.data)
+	_, err := NewReaderAt(bytes.NewReader(sealed), int64(len(sealed)))
+	assert.Equal(t, ErrNotChunked, err)
+}
+
+func TestReaderAtBadTable(t *testing.T) {
+	f, _ := wrapMerkleTemp(t)
+	defer f.Close()
+
+	info, err := f.Stat()
+	require.Nil(t, err)
+
+	_, err = f.WriteAt([]byte("X"), info.Size()-1)
+	require.Nil(t, err)
+	_, err = NewReaderAt(f, info.Size())
+	assert.Equal(t, ErrBadChunkTable, err)
+}
+
+func TestParseHeaderChunksBad(t *testing.T) {
+	claim := strings.Repeat("00", 32)
+	attrs := " chunk=4 length=0000000000000000020\n"
+	for _, header := range []string{
+		"SL%v0{merkle-sha256:" + claim + "}\n",
+		"SL%v0{signify:" + base64.StdEncoding.EncodeToString(make([]byte, 74)) + "}" + attrs,
+		"SL%v0{sha256:~64}" + attrs,
+		"SL%v0{sha256:" + claim + "} parity=5\n",
+		"SL%v0{sha256:" + claim + "}" + attrs[:len(attrs)-1] + " parity=0\n",
+		"SL%v0{sha256:" + claim + "}" + attrs[:len(attrs)-1] + " parity=101\n",
+	} {
+		_, err := parseHeader(bufio.NewReader(strings.NewReader(header)))
+		assert.NotNil(t, err, header)
+	}
+
+	_, err := parseHeader(bufio.NewReader(strings.NewReader("SL%v0{sha256:" + claim + "}" + attrs)))
+	assert.Nil(t, err)
+}
+
+// A header may declare any chunk size, which must not be trusted with memory.
+func TestChunkTooLarge(t *testing.T) {
+	claim := strings.Repeat("00", 32)
+	data := "SL%v0{merkle-sha256:" + claim + "} chunk=4611686018427387904 length=0000000000000000006\nseal!\n"
+
+	_, err := Unwrap(strings.NewReader(data), ioutil.Discard)
+	assert.True(t, errors.Is(err, ErrChunkTooLarge), "%v", err)
+	assert.True(t, errors.Is(err, ErrMalformedHeader), "%v", err)
+
+	_, err = NewReaderAt(strings.NewReader(data), int64(len(data)))
+	assert.True(t, errors.Is(err, ErrChunkTooLarge), "%v", err)
+
+	f, err := ioutil.TempFile("", "seal-merkle-")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = WrapMerkle(strings.NewReader("seal!\n"), f, VariantSHA256, MaxChunkSize+1)
+	assert.Equal(t, ErrBadChunkSize, err)
+}
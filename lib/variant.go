@@ -0,0 +1,81 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// The sha512 variant. The claim is a hex-encoded, optionally truncated,
+// sha512 hash of the content. It is the only variant with a short form.
+const VariantSHA512 = "sha512"
+
+// The variant of a seal written in the short form, `SL%v0{<claim>}`.
+const DefaultVariant = VariantSHA512
+
+var ErrUnknownVariant = errors.New("seal: unknown variant")
+
+// Variant determines how a claim is encoded in the header. Variants are
+// registered by name, which is what appears before the colon in the long
+// form `SL%v0{<name>:<claim>}`.
+type Variant struct {
+	Name string
+
+	// Encodes a claim for the header.
+	EncodeClaim func(claim []byte) string
+
+	// Decodes a claim from the header.
+	DecodeClaim func(claim string) ([]byte, error)
+
+	// Reports whether a decoded claim of n bytes is acceptable.
+	ValidClaimLen func(n int) bool
+}
+
+var variants = map[string]*Variant{}
+
+// Makes a variant available to the header parser. Registering the same name
+// twice panics.
+func RegisterVariant(v *Variant) {
+	if !validVariantName(v.Name) {
+		panic(fmt.Sprintf("seal: invalid variant name %q", v.Name))
+	}
+	if _, dup := variants[v.Name]; dup {
+		panic(fmt.Sprintf("seal: variant %q registered twice", v.Name))
+	}
+	variants[v.Name] = v
+}
+
+// Returns the registered variant with the given name.
+func LookupVariant(name string) (*Variant, error) {
+	v, ok := variants[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownVariant, name)
+	}
+	return v, nil
+}
+
+// Variant names are lowercase letters, digits and dashes.
+func validVariantName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns a variant whose claim is a hex-encoded hash of at most maxBytes.
+func hexVariant(name string, maxBytes int) *Variant {
+	return &Variant{
+		Name:          name,
+		EncodeClaim:   hex.EncodeToString,
+		DecodeClaim:   hex.DecodeString,
+		ValidClaimLen: func(n int) bool { return 1 <= n && n <= maxBytes },
+	}
+}
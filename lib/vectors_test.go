@@ -0,0 +1,248 @@
+package seal
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Regenerate the vectors with `go test -run TestVectors -update`.
+var update = flag.Bool("update", false, "regenerate the test vectors in "+vectorsDir)
+
+const vectorsDir = "testdata/vectors"
+
+// The content of the good vectors, which spans several 4 byte chunks.
+const vectorContent = "seal!\nThe quick brown fox jumps over the lazy dog.\n"
+
+// The errors matching each class of bad vector, which is the part of its name
+// before the first dash. See testdata/vectors/README.md.
+var vectorClasses = map[string]error{
+	"header":    ErrMalformedHeader,
+	"magic":     ErrBadMagic,
+	"version":   ErrUnsupportedVersion,
+	"claim":     ErrMalformedClaim,
+	"toolong":   ErrHeaderTooLong,
+	"variant":   ErrUnknownVariant,
+	"length":    ErrBadSignatureLength,
+	"attribute": ErrMalformedHeader,
+	"broken":    ErrSealBroken,
+	"truncated": io.ErrUnexpectedEOF,
+	"trailing":  ErrTrailingData,
+}
+
+// Seals vectorContent into a temporary file with wrap, and returns the file.
+func sealVector(t *testing.T, wrap func(in io.Reader, out *os.File) error) []byte {
+	f, err := ioutil.TempFile("", "seal-vector-")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	require.Nil(t, wrap(strings.NewReader(vectorContent), f))
+	data, err := ioutil.ReadFile(f.Name())
+	require.Nil(t, err)
+	return data
+}
+
+func wrapWithVector(algo string, bits int) func(io.Reader, *os.File) error {
+	return func(in io.Reader, out *os.File) error {
+		_, err := WrapWith(in, out, algo, bits)
+		return err
+	}
+}
+
+var vectorMetadata = &Metadata{
+	Name:    "seal.txt",
+	Mode:    0644,
+	ModTime: time.Date(2016, 7, 4, 12, 30, 0, 0, time.UTC),
+}
+
+// Returns the good vectors, by name.
+func goodVectors(t *testing.T) map[string][]byte {
+	sum := sha512.Sum512([]byte(vectorContent))
+	long := &Seal{Magic: Magic, Version: Version, Variant: VariantSHA512, ClaimedSignature: sum[:]}
+	short := &Seal{Magic: Magic, Version: Version, ClaimedSignature: sum[:]}
+
+	trailer := &bytes.Buffer{}
+	w, err := NewWriterWith(trailer, VariantSHA256, 256)
+	require.Nil(t, err)
+	io.WriteString(w, vectorContent)
+	require.Nil(t, w.Close())
+
+	return map[string][]byte{
+		"sha512-short":     []byte(short.String() + vectorContent),
+		"sha512-long":      []byte(long.String() + vectorContent),
+		"sha512-truncated": sealVector(t, wrapWithVector(VariantSHA512, 256)),
+		"sha512-crlf":      []byte(strings.TrimSuffix(short.String(), "\n") + "\r\n" + vectorContent),
+		"sha256":           sealVector(t, wrapWithVector(VariantSHA256, 256)),
+		"sha3-512":         sealVector(t, wrapWithVector(VariantSHA3, 512)),
+		"blake2b":          sealVector(t, wrapWithVector(VariantBLAKE2b, 512)),
+		"blake3":           sealVector(t, wrapWithVector(VariantBLAKE3, 256)),
+		"blake3-8bit":      sealVector(t, wrapWithVector(VariantBLAKE3, 8)),
+		"trailer-sha256":   trailer.Bytes(),
+		"merkle-sha256": sealVector(t, func(in io.Reader, out *os.File) error {
+			_, err := WrapMerkle(in, out, VariantSHA256, 4)
+			return err
+		}),
+		"table-sha256": sealVector(t, func(in io.Reader, out *os.File) error {
+			_, err := WrapChunked(in, out, VariantSHA256, 256, 4)
+			return err
+		}),
+		"parity-sha256": sealVector(t, func(in io.Reader, out *os.File) error {
+			_, err := WrapParity(in, out, VariantSHA256, 256, 4, 10)
+			return err
+		}),
+		"metadata-sha256": sealVector(t, func(in io.Reader, out *os.File) error {
+			_, err := WrapMetadata(in, out, VariantSHA256, 256, vectorMetadata)
+			return err
+		}),
+		"signify": sealVector(t, func(in io.Reader, out *os.File) error {
+			_, err := WrapSignify(in, out, testSecretKey())
+			return err
+		}),
+	}
+}
+
+// Returns the bad vectors, by name, made from the good ones.
+func badVectors(t *testing.T, good map[string][]byte) map[string][]byte {
+	header := func(name string) string {
+		data := good[name]
+		return string(data[:bytes.IndexByte(data, '\n')])
+	}
+	replace := func(name, old, new string) []byte {
+		data := good[name]
+		require.True(t, bytes.Contains(data, []byte(old)), "%s: %q", name, old)
+		return bytes.Replace(data, []byte(old), []byte(new), 1)
+	}
+	cut := func(name string, n int) []byte {
+		data := good[name]
+		return data[:len(data)-n]
+	}
+
+	short := header("sha512-short")
+	claim := strings.TrimSuffix(strings.TrimPrefix(short, "SL%v0{"), "}")
+
+	return map[string][]byte{
+		"header-empty":           {},
+		"header-no-newline":      []byte(short),
+		"magic-wrong":            replace("sha512-short", "SL%v", "SL%x"),
+		"magic-text":             []byte("Not a seal.\n" + vectorContent),
+		"version-1":              replace("sha512-short", "SL%v0", "SL%v1"),
+		"version-letter":         replace("sha512-short", "SL%v0", "SL%va"),
+		"claim-unclosed":         replace("sha512-short", "}", ""),
+		"claim-odd-hex":          replace("sha512-short", "}", "0}"),
+		"claim-not-hex":          replace("sha512-short", claim[:2], "zz"),
+		"claim-space":            replace("sha256", "sha256:", "sha256: "),
+		"claim-empty":            []byte("SL%v0{}\n" + vectorContent),
+		"toolong-claim":          []byte("SL%v0{" + strings.Repeat("0", MaxHeaderLen) + "}\n"),
+		"variant-unknown":        replace("sha256", "sha256:", "md5:"),
+		"variant-empty":          replace("sha256", "sha256:", ":"),
+		"length-sha512":          replace("sha512-short", "}", "00}"),
+		"length-sha256":          replace("sha256", "}", "00}"),
+		"attribute-unknown":      replace("sha512-short", "}", "} color=red"),
+		"attribute-duplicate":    replace("table-sha256", " chunk=4", " chunk=4 chunk=4"),
+		"attribute-merkle":       replace("merkle-sha256", " chunk=4", ""),
+		"attribute-name":         replace("metadata-sha256", "name=seal.txt", "name=..%2Fseal.txt"),
+		"attribute-chunk-huge":   replace("merkle-sha256", " chunk=4", " chunk=4611686018427387904"),
+		"broken-content":         replace("sha512-short", "quick", "quack"),
+		"broken-claim":           flipClaim(good["sha256"]),
+		"broken-crlf":            replace("sha512-crlf", "quick", "quack"),
+		"broken-trailer":         replace("trailer-sha256", "quick", "quack"),
+		"broken-merkle":          replace("merkle-sha256", "quick", "quack"),
+		"broken-table":           replace("table-sha256", "quick", "quack"),
+		"broken-metadata":        replace("metadata-sha256", "mode=0644", "mode=0755"),
+		"broken-signify":         replace("signify", "quick", "quack"),
+		"truncated-metadata":     cut("metadata-sha256", 4),
+		"truncated-table":        cut("table-sha256", 4),
+		"truncated-trailer-line": []byte(header("trailer-sha256") + "\n" + vectorContent[:3]),
+		"trailing-metadata":      append(append([]byte{}, good["metadata-sha256"]...), '!'),
+	}
+}
+
+// Returns a copy of a seal with the first digit of its hex claim changed.
+func flipClaim(data []byte) []byte {
+	data = append([]byte{}, data...)
+	i := bytes.IndexByte(data, ':') + 1
+	if data[i] == '0' {
+		data[i] = '1'
+	} else {
+		data[i] = '0'
+	}
+	return data
+}
+
+// Reads a directory of vectors, by name without the .sl extension.
+func readVectors(t testing.TB, dir string) map[string][]byte {
+	files, err := filepath.Glob(filepath.Join(vectorsDir, dir, "*"+".sl"))
+	require.Nil(t, err)
+
+	vectors := map[string][]byte{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		require.Nil(t, err)
+		vectors[strings.TrimSuffix(filepath.Base(file), ".sl")] = data
+	}
+	return vectors
+}
+
+func writeVectors(t *testing.T, dir string, vectors map[string][]byte) {
+	dir = filepath.Join(vectorsDir, dir)
+	require.Nil(t, os.RemoveAll(dir))
+	require.Nil(t, os.MkdirAll(dir, 0755))
+	for name, data := range vectors {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name+".sl"), data, 0644))
+	}
+}
+
+// Unwraps a vector, verifying signify seals with the test key.
+func unwrapVector(data []byte) ([]byte, error) {
+	out := &bytes.Buffer{}
+	if bytes.HasPrefix(data, []byte("SL%v0{signify:")) {
+		_, err := UnwrapSignify(bytes.NewReader(data), out, testSecretKey().Public())
+		return out.Bytes(), err
+	}
+	_, err := Unwrap(bytes.NewReader(data), out)
+	return out.Bytes(), err
+}
+
+func TestVectors(t *testing.T) {
+	good := goodVectors(t)
+	bad := badVectors(t, good)
+	if *update {
+		writeVectors(t, "good", good)
+		writeVectors(t, "bad", bad)
+		pub := testSecretKey().Public().Marshal("signify public key")
+		require.Nil(t, ioutil.WriteFile(filepath.Join(vectorsDir, "signify.pub"), pub, 0644))
+		require.Nil(t, ioutil.WriteFile(filepath.Join(vectorsDir, "content"), []byte(vectorContent), 0644))
+	}
+
+	// The vectors on disk are what other implementations test against, so
+	// they must be up to date.
+	assert.Equal(t, good, readVectors(t, "good"), "run with -update")
+	assert.Equal(t, bad, readVectors(t, "bad"), "run with -update")
+
+	for name, data := range readVectors(t, "good") {
+		content, err := unwrapVector(data)
+		assert.Nil(t, err, name)
+		assert.Equal(t, vectorContent, string(content), name)
+	}
+
+	for name, data := range readVectors(t, "bad") {
+		class := strings.SplitN(name, "-", 2)[0]
+		target, ok := vectorClasses[class]
+		require.True(t, ok, "%s: unknown class %q", name, class)
+
+		_, err := unwrapVector(data)
+		assert.True(t, errors.Is(err, target), "%s: expected %v, got %v", name, target, err)
+	}
+}
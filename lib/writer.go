@@ -0,0 +1,109 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package seal
+
+import (
+	"errors"
+	"hash"
+	"io"
+)
+
+var ErrWriterClosed = errors.New("seal: write to closed Writer")
+
+// Writer seals content in a single pass using the trailer layout: the header
+// only marks how long the claim is, and the claim is written after the
+// content by Close. Unlike Wrap, the output needn't be seekable and nothing
+// is buffered.
+type Writer struct {
+	Seal
+
+	out         io.Writer
+	digest      hash.Hash
+	wroteHeader bool
+	err         error
+}
+
+// Returns a Writer that seals content to `out` with the default variant and
+// number of bits.
+func NewWriter(out io.Writer) *Writer {
+	w, err := NewWriterWith(out, DefaultVariant, DefaultSealBits)
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
+
+// Same as NewWriter, but hashes with the named algorithm, truncated to bits.
+func NewWriterWith(out io.Writer, algo string, bits int) (*Writer, error) {
+	a, err := LookupAlgorithm(algo)
+	if err != nil {
+		return nil, err
+	}
+
+	sigLen := bitsToBytes(bits, a.MaxBytes)
+	if sigLen == -1 {
+		return nil, ErrBadSignatureLength
+	}
+
+	w := &Writer{
+		Seal: Seal{
+			Magic:      Magic,
+			Version:    Version,
+			TrailerLen: sigLen,
+		},
+		out:    out,
+		digest: a.New(),
+	}
+	if algo != DefaultVariant {
+		w.Variant = algo
+	}
+
+	return w, nil
+}
+
+func (w *Writer) writeHeader() error {
+	w.wroteHeader = true
+	_, w.err = io.WriteString(w.out, w.String())
+	return w.err
+}
+
+// Writes content to the underlying writer, writing the header first if
+// needed.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if !w.wroteHeader && w.writeHeader() != nil {
+		return 0, w.err
+	}
+
+	n, err := w.out.Write(p)
+	w.digest.Write(p[:n])
+	w.err = err
+	return n, err
+}
+
+// Writes the claim after the content. Close does not close the underlying
+// writer.
+func (w *Writer) Close() error {
+	if w.err == ErrWriterClosed {
+		return nil
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if !w.wroteHeader && w.writeHeader() != nil {
+		return w.err
+	}
+
+	w.ClaimedSignature = w.digest.Sum(nil)[:w.TrailerLen]
+	_, err := io.WriteString(w.out, w.claimLine())
+	if err != nil {
+		w.err = err
+		return err
+	}
+
+	w.err = ErrWriterClosed
+	return nil
+}
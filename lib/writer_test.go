@@ -0,0 +1,112 @@
+package seal
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	sealed := &bytes.Buffer{}
+	w, err := NewWriterWith(sealed, VariantSHA512, 8)
+	require.Nil(t, err)
+
+	_, err = io.WriteString(w, "seal!\n")
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	assert.Equal(t, "SL%v0{~1}\nseal!\nSL%v0{0d}\n", sealed.String())
+
+	_, err = w.Write([]byte("more"))
+	assert.Equal(t, ErrWriterClosed, err)
+	assert.Nil(t, w.Close())
+}
+
+func TestWriterEmpty(t *testing.T) {
+	sealed := &bytes.Buffer{}
+	w, err := NewWriterWith(sealed, VariantSHA256, 16)
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	assert.Equal(t, "SL%v0{sha256:~2}\nSL%v0{sha256:e3b0}\n", sealed.String())
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	for _, c := range goodCases {
+		sealed := &bytes.Buffer{}
+		w, err := NewWriterWith(sealed, VariantSHA512, c.bits)
+		require.Nil(t, err)
+		_, err = io.WriteString(w, c.data)
+		require.Nil(t, err)
+		require.Nil(t, w.Close())
+
+		r, err := NewReader(bytes.NewReader(sealed.Bytes()))
+		require.Nil(t, err)
+		assert.Equal(t, c.bits/8, r.TrailerLen)
+		assert.Nil(t, r.ClaimedSignature)
+
+		data, err := ioutil.ReadAll(r)
+		require.Nil(t, err)
+		assert.Equal(t, c.data, string(data))
+		assert.Equal(t, c.seal.ClaimedSignature, r.ClaimedSignature)
+
+		unwrapped := &bytes.Buffer{}
+		_, err = Unwrap(bytes.NewReader(sealed.Bytes()), unwrapped)
+		require.Nil(t, err)
+		assert.Equal(t, c.data, unwrapped.String())
+	}
+}
+
+func TestReaderTrailerBad(t *testing.T) {
+	cases := []struct {
+		sealed string
+		err    error
+	}{
+		{"SL%v0{~1}\nSEAL!\nSL%v0{0d}\n", ErrSealBroken},
+		{"SL%v0{~1}\nseal!\nSL%v0{0d}", nil},
+		{"SL%v0{~1}\nSL%v0{0d}", io.ErrUnexpectedEOF},
+		{"SL%v0{~1}\n", io.ErrUnexpectedEOF},
+		{"SL%v0{~1}\nseal!\nSL%v0{sha512:0d}\n", nil},
+		{"SL%v0{~1}\nseal!\nSL%v0{0d0d}\n", nil},
+		{"SL%v0{~1}\nseal!\nSL%v0{~1}\n", nil},
+	}
+
+	for _, c := range cases {
+		r, err := NewReader(bytes.NewBufferString(c.sealed))
+		require.Nil(t, err)
+
+		_, err = ioutil.ReadAll(r)
+		require.NotNil(t, err, c.sealed)
+		if c.err != nil {
+			assert.Equal(t, c.err, err)
+		}
+	}
+}
+
+func TestParseHeaderTrailerBad(t *testing.T) {
+	for _, header := range []string{
+		"SL%v0{~0}\n", "SL%v0{~65}\n", "SL%v0{~+1}\n", "SL%v0{~}\n", "SL%v0{signify:~8}\n",
+	} {
+		_, err := NewReader(bytes.NewBufferString(header))
+		assert.NotNil(t, err, header)
+	}
+}
+
+func TestWriterRoundTripLarge(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 16*1024+3)
+
+	sealed := &bytes.Buffer{}
+	w := NewWriter(sealed)
+	_, err := io.Copy(w, iotest.HalfReader(bytes.NewReader(data)))
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	r, err := NewReader(iotest.OneByteReader(bytes.NewReader(sealed.Bytes())))
+	require.Nil(t, err)
+	unwrapped, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	assert.Equal(t, data, unwrapped)
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/jessevdk/go-flags"
 )
@@ -17,28 +18,57 @@ var opt struct {
 	Unwrap bool `short:"U" long:"unwrap" description:"Unwrap (extract) a sealed file."`
 	Check  bool `short:"C" long:"check" description:"Check a seal for corrupted file contents."`
 	Dump   bool `short:"D" long:"dump" description:"Dump raw seal header."`
-	// Info    bool `short:"I" long:"info" description:"View seal header information."`
+	Repair bool `short:"R" long:"repair" description:"Repair a sealed file with parity, writing the repaired seal."`
+	Info   bool `short:"I" long:"info" description:"View seal header information."`
+
+	Manifest       bool `long:"manifest" description:"Write a sealed manifest of every file in a directory."`
+	VerifyManifest bool `long:"verify-manifest" description:"Check a directory against a sealed manifest."`
+	FromSums       bool `long:"from-sums" description:"Seal the files listed in a checksum file, like SHA512SUMS, if they still match."`
+	ToSums         bool `long:"to-sums" description:"Write a checksum file for sha512sum -c listing the content of seals."`
 
 	Output  string `short:"o" long:"output" description:"Write output to a file."`
 	Verbose bool   `short:"v" long:"verbose" description:"Enable verbose debug output"`
 
 	Force bool `long:"force" description:"Overwrite files. Required when inferring filenames."`
 
-	//Timid      bool `short:"t" long:"timid" description:"Do not allow invalid files to be extracted."`
-	//Lax   bool `short:"l" long:"lax" description:"Allow partial and unverified extraction"`
-	//Quiet bool `short:"q" long:"quiet" description:"Silence all non-data output to stdout or stderr."`
+	Recursive bool     `short:"r" long:"recursive" description:"Process every file in the given directories."`
+	Symlinks  bool     `long:"follow-symlinks" description:"Follow symbolic links when recursing, instead of skipping them."`
+	Include   []string `long:"include" description:"Only process files whose names match a glob. May be repeated."`
+	Exclude   []string `long:"exclude" description:"Skip files and directories whose names match a glob. May be repeated."`
+	Format    string   `long:"format" description:"Output format of checks, or of --info with json." choice:"text" choice:"json" choice:"jsonl" default:"text"`
+	Jobs      int      `short:"j" long:"jobs" description:"Number of files to check at once. Defaults to the number of CPUs."`
+
+	Timid bool `short:"t" long:"timid" description:"Do not allow invalid files to be extracted."`
+	Lax   bool `short:"l" long:"lax" description:"Allow partial and unverified extraction"`
+	Quiet bool `short:"q" long:"quiet" description:"Silence all non-data output to stdout or stderr. The exit status reports the outcome."`
+
+	Size int    `short:"s" long:"size" description:"Truncated size of hash in bits." default:"256"`
+	Algo string `short:"a" long:"algo" description:"Hash algorithm (sha512, sha256, sha3-512, blake2b, blake3)." default:"sha512"`
+
+	Merkle bool   `long:"merkle" description:"Seal as a merkle tree of chunks, for random access and locating corruption."`
+	Table  bool   `long:"table" description:"Store a table of chunk hashes after the content, for locating corruption."`
+	Chunk  int64  `long:"chunk" description:"Size of merkle and table chunks in bytes." default:"1048576"`
+	Parity string `long:"parity" description:"Store parity for repairing corruption, as a percentage of the content (e.g. 5%)."`
+
+	InPlace    bool `long:"in-place" description:"Replace each input with its output, keeping its mode, owner and mtime."`
+	NoPreserve bool `long:"no-preserve" description:"Don't copy the mode and mtime of the input to the output."`
+
+	Progress bool `long:"progress" description:"Show a progress bar on stderr while reading the input."`
 
-	Size int `short:"s" long:"size" description:"Truncated size of SHA512 hash in bits." default:"256"`
+	NoMeta bool `long:"no-metadata" description:"Don't record the file name, mode and mtime when wrapping, or use them when unwrapping."`
+
+	Sign   string `long:"sign" description:"Sign with a signify secret key when wrapping."`
+	PubKey string `long:"pubkey" description:"Verify a signify seal with a public key."`
 
 	Debug bool `long:"debug" description:"Log debug information."`
 }
 
-// Slightly complex exit-on-error function. Can handle arbitrary inputs,
-// but if the first argument is a string, the remaining arguments can be
-// inserted into the string printf-style.
+// Slightly complex exit-on-error function for usage errors. Can handle
+// arbitrary inputs, but if the first argument is a string, the remaining
+// arguments can be inserted into the string printf-style.
 func die(a ...interface{}) {
 	if a == nil || len(a) == 0 {
-		os.Exit(1)
+		os.Exit(ExitUsage)
 	}
 
 	buf := bytes.NewBufferString("Error: ")
@@ -56,7 +86,7 @@ func die(a ...interface{}) {
 	}
 
 	buf.WriteTo(os.Stderr)
-	os.Exit(1)
+	os.Exit(ExitUsage)
 }
 
 func help(p *flags.Parser) {
@@ -87,6 +117,69 @@ func main() {
 		die(err)
 	}
 
+	if cmd != Check && opt.Format != FormatText {
+		if cmd != Info || opt.Format != FormatJSON {
+			die("--format only applies to --check, or to --info with json.")
+		}
+		if opt.Recursive || len(args) > 1 {
+			die("--format json with --info takes one input.")
+		}
+	}
+	if opt.Timid && opt.Lax {
+		die("--timid and --lax can't be used together.")
+	}
+	if opt.InPlace {
+		if cmd != Wrap && cmd != Unwrap {
+			die("--in-place only applies to --wrap and --unwrap.")
+		}
+		if opt.Output != "" {
+			die("--in-place can't be used with --output.")
+		}
+		// A salvage must never replace the only sealed copy.
+		if opt.Lax {
+			die("--in-place can't be used with --lax.")
+		}
+	}
+	if opt.Quiet && opt.Format != FormatText {
+		die("--quiet can't be used with --format.")
+	}
+	if opt.Progress {
+		if cmd != Wrap && cmd != Unwrap && cmd != Check {
+			die("--progress only applies to --wrap, --unwrap and --check.")
+		}
+		if opt.Quiet {
+			die("--progress can't be used with --quiet.")
+		}
+		if opt.Recursive || len(args) > 1 || opt.Format != FormatText {
+			die("--progress can't be used with more than one input.")
+		}
+	}
+
+	if cmd == Manifest || cmd == VerifyManifest {
+		os.Exit(runManifest(cmd, args))
+	}
+	if cmd == FromSums {
+		if len(args) != 1 {
+			die("--from-sums takes one checksum file.")
+		}
+		os.Exit(fromSums(args[0]))
+	}
+	if cmd == ToSums {
+		os.Exit(toSums(args))
+	}
+
+	// Machine-readable checks are always reported like checks of many
+	// files, even for a single input.
+	if opt.Recursive || len(args) > 1 || (cmd == Check && opt.Format != FormatText) {
+		if opt.Output != "" {
+			die("An output file can't be given for more than one input.")
+		}
+		if len(args) == 0 {
+			args = []string{"-"}
+		}
+		os.Exit(runMany(cmd, args))
+	}
+
 	inArg := ""
 	outArg := opt.Output
 
@@ -99,13 +192,29 @@ func main() {
 	if len(args) == 1 {
 		// We were given an explicit input, so use it. Might still be stdio ("-").
 		inArg = args[0]
-	} else if len(args) > 1 {
-		die("Too many input arguments. Expected only one.")
 	}
 
+	err = run(cmd, inArg, outArg)
+	if err != nil {
+		fail(err)
+	}
+}
+
+// Runs the command on a single input, inferring the output if outArg is
+// empty.
+func run(cmd Command, inArg, outArg string) error {
 	in, out, err := determineInputOutput(cmd, inArg, outArg)
+	if cmd == Unwrap && isExplicit(inArg) && outArg == "" && !opt.NoMeta {
+		if name := metadataOutput(in); name != "" {
+			out, err = name, nil
+		}
+	}
 	if err != nil {
-		die(err)
+		return err
+	}
+	if opt.InPlace && (!isExplicit(inArg) || !isExplicit(out) ||
+		filepath.Clean(in) == filepath.Clean(out)) {
+		return usageError("--in-place requires an input file with a different output")
 	}
 
 	if opt.Verbose {
@@ -114,14 +223,17 @@ func main() {
 
 	inFile, outFile, err := openInputOutput(cmd, opt.Force, in, out)
 	defer inFile.Close()
-	defer outFile.Close()
 
-	if err != nil {
-		die(err)
+	if err == nil {
+		err = dispatch(cmd, inFile, outFile.File)
+	}
+	if outFile != nil {
+		err = outFile.finish(err)
 	}
 
-	err = dispatch(cmd, inFile, outFile)
-	if err != nil {
-		die(err)
+	// The output is in place, so losing the input now loses nothing.
+	if err == nil && opt.InPlace {
+		err = os.Remove(in)
 	}
+	return err
 }
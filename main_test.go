@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	seal "github.com/crasm/seal/lib"
+)
+
+// Returns the names of the files in dir.
+func listDir(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRunInPlace(t *testing.T) {
+	saved := opt
+	defer func() { opt = saved }()
+	opt.Algo, opt.Size, opt.Chunk = "sha512", 512, 1<<20
+	opt.InPlace = true
+
+	dir, err := ioutil.TempDir("", "seal-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	photo := filepath.Join(dir, "photo")
+	content := bytes.Repeat([]byte("seal!\n"), 1000)
+	err = ioutil.WriteFile(photo, content, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The original is only removed once its replacement is in place.
+	err = run(Wrap, photo, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := listDir(t, dir); !reflect.DeepEqual(names, []string{"photo.sl"}) {
+		t.Errorf("expected only photo.sl after wrapping, got %v", names)
+	}
+	sealed, err := ioutil.ReadFile(photo + ".sl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed unwrap leaves the seal alone, and no partial output or
+	// temporary file behind.
+	broken := bytes.Replace(sealed, []byte("seal!"), []byte("seal?"), 1)
+	err = ioutil.WriteFile(photo+".sl", broken, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = run(Unwrap, photo+".sl", "")
+	if err != seal.ErrSealBroken {
+		t.Errorf("expected %v, got %v", seal.ErrSealBroken, err)
+	}
+	if names := listDir(t, dir); !reflect.DeepEqual(names, []string{"photo.sl"}) {
+		t.Errorf("expected only photo.sl after a failed unwrap, got %v", names)
+	}
+
+	err = ioutil.WriteFile(photo+".sl", sealed, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = run(Unwrap, photo+".sl", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := listDir(t, dir); !reflect.DeepEqual(names, []string{"photo"}) {
+		t.Errorf("expected only photo after unwrapping, got %v", names)
+	}
+	data, err := ioutil.ReadFile(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("expected the original content back, got %d bytes", len(data))
+	}
+
+	// A wrap that fails once its output is open doesn't remove the
+	// original either.
+	opt.Algo = "md5"
+	err = run(Wrap, photo, "")
+	if err == nil {
+		t.Errorf("expected an error for an unknown algorithm")
+	}
+	if names := listDir(t, dir); !reflect.DeepEqual(names, []string{"photo"}) {
+		t.Errorf("expected only photo after a failed wrap, got %v", names)
+	}
+}
+
+// --lax keeps what it extracts from a truncated or broken seal, but still
+// reports it as broken.
+func TestRunLax(t *testing.T) {
+	saved := opt
+	defer func() { opt = saved }()
+	opt.Algo, opt.Size, opt.Chunk = "sha512", 512, 1<<20
+
+	dir, err := ioutil.TempDir("", "seal-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	doc := filepath.Join(dir, "doc")
+	content := bytes.Repeat([]byte("seal!\n"), 1000)
+	err = ioutil.WriteFile(doc, content, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Seals record metadata by default, and so their length.
+	err = run(Wrap, doc, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := ioutil.ReadFile(doc + ".sl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		sealed   []byte
+		expected []byte
+	}{
+		{sealed[:len(sealed)-100], content[:len(content)-100]},
+		{bytes.Replace(sealed, []byte("seal!"), []byte("seal?"), 1),
+			bytes.Replace(content, []byte("seal!"), []byte("seal?"), 1)},
+	}
+
+	opt.Lax = true
+	for i, c := range cases {
+		err = ioutil.WriteFile(doc+".sl", c.sealed, 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := filepath.Join(dir, "salvaged")
+		os.Remove(out)
+
+		err = run(Unwrap, doc+".sl", out)
+		if code := exitCode(err); code != ExitBroken {
+			t.Errorf("case %d: expected exit status %d, got %d (%v)", i, ExitBroken, code, err)
+		}
+		data, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+		} else if !bytes.Equal(data, c.expected) {
+			t.Errorf("case %d: expected %d salvaged bytes, got %d", i, len(c.expected), len(data))
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	seal "github.com/crasm/seal/lib"
+	"github.com/crasm/seal/lib/manifest"
+)
+
+const ManifestExtension = ".manifest" + FileExtension
+
+// Runs --manifest or --verify-manifest, and returns the exit status.
+func runManifest(cmd Command, args []string) int {
+	var err error
+	code := ExitOK
+
+	switch {
+	case cmd == Manifest && len(args) == 1:
+		err = writeManifest(args[0])
+	case cmd == VerifyManifest && (len(args) == 1 || len(args) == 2):
+		dir := strings.TrimSuffix(args[0], ManifestExtension)
+		if len(args) == 2 {
+			dir = args[1]
+		} else if dir == args[0] {
+			err = usageError("directory required")
+			break
+		}
+		code, err = verifyManifest(args[0], dir)
+	case cmd == Manifest:
+		die("--manifest takes one directory.")
+	default:
+		die("--verify-manifest takes a manifest and optionally its directory.")
+	}
+
+	if err != nil {
+		fail(err)
+	}
+	return code
+}
+
+// Writes a sealed manifest of dir, to dir.manifest.sl unless --output is
+// given.
+func writeManifest(dir string) error {
+	out := opt.Output
+	if out == "" {
+		out = filepath.Clean(dir) + ManifestExtension
+	}
+
+	m, err := manifest.Build(os.DirFS(dir), opt.Algo)
+	if err != nil {
+		return err
+	}
+	self := relPath(dir, out)
+	for i, e := range m.Entries {
+		if e.Path == self {
+			m.Entries = append(m.Entries[:i], m.Entries[i+1:]...)
+			break
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	m.WriteTo(buf)
+
+	outFile, err := createOutput(out, opt.Force || opt.Output != "")
+	if err == nil {
+		_, err = seal.Wrap(buf, outFile, seal.WithAlgorithm(opt.Algo), seal.WithBits(opt.Size))
+	}
+	return outFile.finish(err)
+}
+
+// Checks dir against the sealed manifest at path, printing a line for each
+// file that differs and a summary. Returns the exit status.
+func verifyManifest(path, dir string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	buf := &bytes.Buffer{}
+	_, err = unwrap(f, buf)
+	if err != nil {
+		return 0, err
+	}
+	m, err := manifest.Parse(buf)
+	if err != nil {
+		return 0, err
+	}
+
+	diffs, ok, err := m.Verify(os.DirFS(dir))
+	if err != nil {
+		return 0, err
+	}
+
+	self := relPath(dir, path)
+
+	out := reporter(os.Stdout)
+	counts := map[manifest.Status]int{}
+	errored := 0
+	code := ExitOK
+	for _, d := range diffs {
+		if d.Status == manifest.Extra && d.Path == self {
+			continue
+		}
+		if d.Err != nil {
+			fmt.Fprintf(out, "%s: ERROR (%v)\n", d.Path, d.Err)
+			errored++
+			code = ExitIO
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s\n", d.Path, strings.ToUpper(d.Status.String()))
+		counts[d.Status]++
+		if code == ExitOK {
+			code = ExitBroken
+		}
+	}
+
+	fmt.Fprintf(out, "%d ok, %d missing, %d extra, %d modified, %d corrupt, %d errored\n",
+		ok, counts[manifest.Missing], counts[manifest.Extra],
+		counts[manifest.Modified], counts[manifest.Corrupt], errored)
+	return code, nil
+}
+
+// Returns the path of a manifest relative to the directory it lists, so that a
+// manifest kept inside its directory isn't listed in itself.
+func relPath(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Gives `to` the owner and group in info. Only root can give a file away, so
+// failing to is not an error.
+func preserveOwner(info os.FileInfo, to *os.File) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if ok {
+		to.Chown(int(st.Uid), int(st.Gid))
+	}
+}
@@ -0,0 +1,9 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package main
+
+import "os"
+
+// Files on Windows don't have an owner that can be set like this.
+func preserveOwner(info os.FileInfo, to *os.File) {}
@@ -0,0 +1,86 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	seal "github.com/crasm/seal/lib"
+)
+
+// How often the progress bar is redrawn.
+const progressInterval = 100 * time.Millisecond
+
+const progressWidth = 30
+
+// progressBar draws how much of an input has been read on a single line,
+// which is redrawn in place.
+type progressBar struct {
+	out         io.Writer
+	name        string
+	done, total int64
+	drawn       time.Time
+}
+
+// Returns `in`, reporting the progress of reading it on stderr if --progress
+// was given, along with the options that report to the same progress bar, if
+// any. The returned function ends the progress bar.
+func withProgress(in *os.File) (io.Reader, []seal.Option, func()) {
+	if !opt.Progress {
+		return in, nil, func() {}
+	}
+
+	p := &progressBar{out: os.Stderr, name: in.Name(), total: -1}
+	opts := []seal.Option{seal.WithProgress(p.update)}
+	return seal.NewContextReader(context.Background(), in, opts...), opts, p.finish
+}
+
+func (p *progressBar) update(done, total int64) {
+	p.done, p.total = done, total
+	if time.Since(p.drawn) >= progressInterval {
+		p.draw()
+	}
+}
+
+// Draws the final state of the bar, and moves to the next line.
+func (p *progressBar) finish() {
+	p.draw()
+	fmt.Fprintln(p.out)
+}
+
+func (p *progressBar) draw() {
+	p.drawn = time.Now()
+	if p.total < 0 {
+		fmt.Fprintf(p.out, "\r%s %10s", p.name, formatBytes(p.done))
+		return
+	}
+
+	fraction := 1.0
+	if p.done < p.total {
+		fraction = float64(p.done) / float64(p.total)
+	}
+	filled := int(fraction * progressWidth)
+	fmt.Fprintf(p.out, "\r%s %3d%% [%s%s] %10s / %s", p.name, int(fraction*100),
+		strings.Repeat("#", filled), strings.Repeat(" ", progressWidth-filled),
+		formatBytes(p.done), formatBytes(p.total))
+}
+
+// Formats a number of bytes with a binary prefix, like "1.5 GiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
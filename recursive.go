@@ -0,0 +1,304 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crasm/seal/lib/batch"
+)
+
+// Counts of the outcomes of running a command on many files. Files may be
+// added from several goroutines.
+type tally struct {
+	mu                  sync.Mutex
+	ok, broken, errored int
+	code                int // The highest exit status of any file.
+
+	reports []*checkReport // Kept for --format json.
+}
+
+// Prints the status line for a file and counts it.
+func (t *tally) add(path string, err error) {
+	t.addResult(&batch.Result{Path: path, Err: err})
+}
+
+// Same as add, but reports everything known about a checked file in the
+// machine-readable formats.
+func (t *tally) addResult(r *batch.Result) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if code := exitCode(r.Err); code > t.code {
+		t.code = code
+	}
+
+	st := status(r.Err)
+	switch st {
+	case StatusOK:
+		t.ok++
+	case StatusBroken:
+		t.broken++
+	default:
+		t.errored++
+	}
+
+	switch opt.Format {
+	case FormatJSON:
+		t.reports = append(t.reports, newCheckReport(r))
+	case FormatJSONL:
+		json.NewEncoder(os.Stdout).Encode(newCheckReport(r))
+	default:
+		out := reporter(os.Stdout)
+		if r.Err == nil {
+			fmt.Fprintf(out, "%s: OK\n", r.Path)
+		} else {
+			fmt.Fprintf(out, "%s: %s (%v)\n", r.Path, strings.ToUpper(st), r.Err)
+		}
+	}
+}
+
+// Runs the command on every input, and every file in directories given with
+// --recursive. Prints a status line per file and a summary, and returns the
+// exit status. Checks run in parallel.
+func runMany(cmd Command, args []string) int {
+	if cmd == Repair {
+		die("Repair takes only one input.")
+	}
+
+	for _, globs := range [][]string{opt.Include, opt.Exclude} {
+		for _, glob := range globs {
+			_, err := filepath.Match(glob, "")
+			if err != nil {
+				die(fmt.Errorf("Invalid glob %q: %v", glob, err))
+			}
+		}
+	}
+
+	t := &tally{}
+	w := &walker{cmd: cmd, visit: func(path string, err error) {
+		if err == nil {
+			err = run(cmd, path, "")
+		}
+		t.add(path, err)
+	}}
+
+	if cmd == Check {
+		checkMany(t, w, args)
+	} else {
+		w.walkArgs(args, t)
+		fmt.Fprintf(reporter(os.Stdout), "%d ok, %d broken, %d errored\n",
+			t.ok, t.broken, t.errored)
+	}
+
+	return t.code
+}
+
+// Checks the files found by w with a pool of --jobs workers, and prints how
+// much content was hashed.
+func checkMany(t *tally, w *walker, args []string) {
+	v := &batch.Verifier{Workers: opt.Jobs}
+	if opt.PubKey != "" {
+		key, err := loadPublicKey(opt.PubKey)
+		if err != nil {
+			fail(err)
+		}
+		v.PublicKey = key
+	}
+
+	paths := make(chan string)
+	w.visit = func(path string, err error) {
+		if err != nil {
+			t.add(path, err)
+			return
+		}
+		paths <- path
+	}
+	go func() {
+		w.walkArgs(args, t)
+		close(paths)
+	}()
+
+	results := make(chan batch.Result)
+	done := make(chan *batch.Totals)
+	go func() {
+		totals, _ := v.Run(context.Background(), paths, results)
+		done <- totals
+	}()
+
+	for r := range results {
+		t.addResult(&r)
+	}
+
+	totals := <-done
+	switch opt.Format {
+	case FormatJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(checkDocument{
+			Results: t.reports,
+			Totals:  newTotalsReport(t, totals),
+		})
+	case FormatJSONL:
+	default:
+		out := reporter(os.Stdout)
+		fmt.Fprintf(out, "%d ok, %d broken, %d errored\n", t.ok, t.broken, t.errored)
+		fmt.Fprintf(out, "%d bytes hashed in %v (%.1f MB/s)\n", totals.Bytes,
+			totals.Elapsed.Round(time.Millisecond), totals.Throughput()/1e6)
+	}
+}
+
+// walker finds the files a command should run on.
+type walker struct {
+	cmd   Command
+	visit func(path string, err error) // err is set if path can't be read.
+
+	// Every directory that has been walked, so a symbolic link can't lead
+	// into one again, whether it's an ancestor or a sibling.
+	entered []os.FileInfo
+}
+
+// Visits every input argument, counting those that can't be read.
+func (w *walker) walkArgs(args []string, t *tally) {
+	for _, arg := range args {
+		err := w.walkArg(arg)
+		if err != nil {
+			t.add(arg, err)
+		}
+	}
+}
+
+// Visits an input argument, which is used as given if it's a file.
+func (w *walker) walkArg(arg string) error {
+	if !isExplicit(arg) {
+		arg = stdin
+	}
+
+	info, err := os.Stat(arg)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		w.visit(arg, nil)
+		return nil
+	}
+	if !opt.Recursive {
+		return usageError("is a directory (use --recursive)")
+	}
+
+	return w.walkDir(arg, info)
+}
+
+// Reports whether the directory described by info has been walked, and
+// records that it has.
+func (w *walker) enter(info os.FileInfo) bool {
+	for _, e := range w.entered {
+		if os.SameFile(e, info) {
+			return true
+		}
+	}
+	w.entered = append(w.entered, info)
+	return false
+}
+
+// Visits the files in the directory root, which may be a symbolic link to
+// one. Paths are reported under root even if it's a link. A directory that
+// has been walked already, through another link or argument, is skipped.
+func (w *walker) walkDir(root string, info os.FileInfo) error {
+	if w.enter(info) {
+		return nil
+	}
+
+	// WalkDir doesn't enter a link given as its root, so the directory it
+	// resolves to is walked instead.
+	real, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(real, func(path string, d fs.DirEntry, err error) error {
+		if path == real {
+			return err
+		}
+		if rel, rerr := filepath.Rel(real, path); rerr == nil {
+			path = filepath.Join(root, rel)
+		}
+		if err != nil {
+			w.visit(path, err)
+			return nil
+		}
+		if matchAny(opt.Exclude, d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				w.visit(path, err)
+				return filepath.SkipDir
+			}
+			if w.enter(info) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			if !opt.Symlinks {
+				return nil
+			}
+			target, err := os.Stat(path)
+			if err != nil {
+				w.visit(path, err)
+				return nil
+			}
+			if target.IsDir() {
+				err = w.walkDir(path, target)
+				if err != nil {
+					w.visit(path, err)
+				}
+				return nil
+			}
+			if !target.Mode().IsRegular() {
+				return nil
+			}
+		} else if !d.Type().IsRegular() {
+			return nil
+		}
+
+		if w.wants(d.Name()) {
+			w.visit(path, nil)
+		}
+		return nil
+	})
+}
+
+// Reports whether a file found in a directory should be processed. Wrapping
+// skips sealed files, and everything else only looks at sealed files.
+func (w *walker) wants(name string) bool {
+	if (w.cmd == Wrap) == strings.HasSuffix(name, FileExtension) {
+		return false
+	}
+	return len(opt.Include) == 0 || matchAny(opt.Include, name)
+}
+
+func matchAny(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, _ := filepath.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestWalker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seal-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(saved []string) { opt.Include = saved }(opt.Include)
+	defer func(saved []string) { opt.Exclude = saved }(opt.Exclude)
+	defer func(r, s bool) { opt.Recursive, opt.Symlinks = r, s }(opt.Recursive, opt.Symlinks)
+
+	// top holds a link to other, which links back to top, a link to
+	// itself, and a link to its own subdirectory.
+	for _, name := range []string{"top/a", "top/a.sl", "top/sub/b", "top/skip/c", "other/d"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, nil, DefaultPerm)
+	}
+	os.Symlink(filepath.Join(dir, "other"), filepath.Join(dir, "top/linked"))
+	os.Symlink(filepath.Join(dir, "top"), filepath.Join(dir, "other/up"))
+	os.Symlink(".", filepath.Join(dir, "top/loop"))
+	os.Symlink("sub", filepath.Join(dir, "top/sublink"))
+	os.Symlink("top", filepath.Join(dir, "toplink"))
+	os.Symlink(filepath.Join(dir, "top/a"), filepath.Join(dir, "top/sub/a-link"))
+
+	cases := []struct {
+		arg       string
+		recursive bool
+		symlinks  bool
+		include   []string
+		exclude   []string
+		expected  []string
+		err       bool
+	}{
+		{"top/a", false, false, nil, nil, []string{"top/a"}, false},
+		{"top", false, false, nil, nil, nil, true},
+		{"top", true, false, nil, nil, []string{"top/a", "top/skip/c", "top/sub/b"}, false},
+		{"top", true, true, nil, nil,
+			[]string{"top/a", "top/linked/d", "top/skip/c", "top/sub/a-link", "top/sub/b"}, false},
+		// A link given as an argument is followed, even without
+		// --follow-symlinks.
+		{"toplink", true, false, nil, nil, []string{"toplink/a", "toplink/skip/c", "toplink/sub/b"}, false},
+		{"toplink", true, true, nil, []string{"skip", "sub"},
+			[]string{"toplink/a", "toplink/linked/d", "toplink/sublink/a-link", "toplink/sublink/b"}, false},
+		{"top", true, false, []string{"b", "c"}, []string{"skip"}, []string{"top/sub/b"}, false},
+		{"missing", true, false, nil, nil, nil, true},
+	}
+
+	for i, c := range cases {
+		opt.Recursive, opt.Symlinks = c.recursive, c.symlinks
+		opt.Include, opt.Exclude = c.include, c.exclude
+
+		var visited []string
+		w := &walker{cmd: Wrap, visit: func(path string, err error) {
+			if err != nil {
+				t.Errorf("case %d: %s: %v", i, path, err)
+			}
+			rel, _ := filepath.Rel(dir, path)
+			visited = append(visited, filepath.ToSlash(rel))
+		}}
+		err := w.walkArg(filepath.Join(dir, c.arg))
+		if (err != nil) != c.err {
+			t.Errorf("case %d: expected error %v, got %v", i, c.err, err)
+		}
+
+		sort.Strings(visited)
+		if !reflect.DeepEqual(visited, c.expected) {
+			t.Errorf("case %d: expected %v, got %v", i, c.expected, visited)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	seal "github.com/crasm/seal/lib"
+	"github.com/crasm/seal/lib/batch"
+)
+
+// Output formats for checks. JSON prints a single document once every file
+// has been checked, and JSON Lines prints a checkReport per line as each
+// file is checked. --info also prints an infoReport as JSON.
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatJSONL = "jsonl"
+)
+
+// The statuses of a checked file.
+const (
+	StatusOK     = "ok"
+	StatusBroken = "broken"
+	StatusError  = "error"
+)
+
+// checkReport is the machine-readable result of checking one file. Every
+// field is always present; strings are empty and numbers zero when unknown.
+type checkReport struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+
+	// Variant is resolved, so the short form is reported as sha512.
+	Variant string `json:"variant"`
+
+	// Claims are encoded as in the header. Calculated is empty for
+	// variants that are verified rather than recalculated, like signify.
+	Claim      string `json:"claim"`
+	Calculated string `json:"calculated"`
+	Bits       int    `json:"bits"`
+
+	Size    int64         `json:"size"` // Bytes of content read.
+	Corrupt []rangeReport `json:"corrupt"`
+}
+
+type rangeReport struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// The document printed by --format json.
+type checkDocument struct {
+	Results []*checkReport `json:"results"`
+	Totals  totalsReport   `json:"totals"`
+}
+
+type totalsReport struct {
+	Files   int `json:"files"`
+	OK      int `json:"ok"`
+	Broken  int `json:"broken"`
+	Errored int `json:"errored"`
+
+	Bytes      int64   `json:"bytes"`
+	Seconds    float64 `json:"seconds"`
+	Throughput float64 `json:"throughput"` // Bytes per second.
+}
+
+// infoReport is the machine-readable description of a seal's header. Like
+// checkReport, every field is always present.
+type infoReport struct {
+	Header string `json:"header"`
+	Valid  bool   `json:"valid"`
+	Error  string `json:"error"`
+
+	Magic   string `json:"magic"`
+	Version int    `json:"version"`
+	Variant string `json:"variant"`
+
+	// Claim is encoded as in the header, and empty if it's in a trailer.
+	Claim   string `json:"claim"`
+	Bits    int    `json:"bits"`
+	Trailer bool   `json:"trailer"`
+
+	HeaderLength  int   `json:"header_length"`
+	ContentOffset int64 `json:"content_offset"`
+
+	// Length is only known if the header records it, along with chunking
+	// or metadata.
+	Length int64 `json:"length"`
+	Chunk  int64 `json:"chunk"`
+	Parity int   `json:"parity"`
+
+	// The metadata is empty unless it was recorded.
+	Name  string `json:"name"`
+	Mode  string `json:"mode"`
+	MTime string `json:"mtime"`
+}
+
+func newInfoReport(hi *seal.HeaderInfo) *infoReport {
+	rep := &infoReport{
+		Header:        hi.Header,
+		Valid:         hi.WellFormed(),
+		Bits:          hi.ClaimBits,
+		HeaderLength:  hi.HeaderLen,
+		ContentOffset: hi.ContentOffset,
+	}
+	if !rep.Valid {
+		rep.Error = hi.Err.Error()
+		return rep
+	}
+
+	sl := hi.Seal
+	rep.Magic, rep.Version = sl.Magic, sl.Version
+	rep.Variant = sl.VariantName()
+	rep.Trailer = sl.TrailerLen > 0
+	if v, err := seal.LookupVariant(rep.Variant); err == nil && !rep.Trailer {
+		rep.Claim = v.EncodeClaim(sl.ClaimedSignature)
+	}
+	rep.Length, rep.Chunk, rep.Parity = sl.Length, sl.ChunkSize, sl.Parity
+	if m := sl.Metadata; m != nil {
+		rep.Name = m.Name
+		rep.Mode = fmt.Sprintf("%04o", uint32(m.Mode))
+		rep.MTime = m.ModTime.Format(time.RFC3339Nano)
+	}
+	return rep
+}
+
+// Returns the status of a file, which agrees with its exit status.
+func status(err error) string {
+	switch exitCode(err) {
+	case ExitOK:
+		return StatusOK
+	case ExitBroken:
+		return StatusBroken
+	default:
+		return StatusError
+	}
+}
+
+func newCheckReport(r *batch.Result) *checkReport {
+	rep := &checkReport{
+		Path:    r.Path,
+		Status:  status(r.Err),
+		Size:    r.Bytes,
+		Corrupt: []rangeReport{},
+	}
+	if r.Err != nil {
+		rep.Error = r.Err.Error()
+	}
+
+	var cerr *seal.CorruptionError
+	if errors.As(r.Err, &cerr) {
+		for _, rg := range cerr.Ranges {
+			rep.Corrupt = append(rep.Corrupt, rangeReport{rg.Offset, rg.Length})
+		}
+	}
+
+	if r.Seal == nil {
+		return rep
+	}
+	rep.Variant = r.Seal.VariantName()
+	rep.Bits = len(r.Seal.ClaimedSignature) * 8
+
+	v, err := seal.LookupVariant(rep.Variant)
+	if err != nil {
+		return rep
+	}
+	if r.Seal.ClaimedSignature != nil {
+		rep.Claim = v.EncodeClaim(r.Seal.ClaimedSignature)
+	}
+	if r.Seal.CalculatedSignature != nil {
+		rep.Calculated = v.EncodeClaim(r.Seal.CalculatedSignature)
+	}
+	return rep
+}
+
+func newTotalsReport(t *tally, totals *batch.Totals) totalsReport {
+	return totalsReport{
+		Files:      t.ok + t.broken + t.errored,
+		OK:         t.ok,
+		Broken:     t.broken,
+		Errored:    t.errored,
+		Bytes:      totals.Bytes,
+		Seconds:    totals.Elapsed.Seconds(),
+		Throughput: totals.Throughput(),
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	seal "github.com/crasm/seal/lib"
+	"github.com/crasm/seal/lib/batch"
+)
+
+func TestCheckReport(t *testing.T) {
+	t.Parallel()
+
+	sl := &seal.UnwrappedSeal{
+		Seal: seal.Seal{
+			Magic:            seal.Magic,
+			Version:          seal.Version,
+			ClaimedSignature: []byte{0xab, 0xcd},
+		},
+		CalculatedSignature: []byte{0xab, 0xce},
+	}
+	cerr := &seal.CorruptionError{Ranges: []seal.Range{{Offset: 4, Length: 2}}}
+
+	cases := []struct {
+		result *batch.Result
+		json   string
+	}{
+		{
+			result: &batch.Result{Path: "a.sl", Err: errors.New("oops")},
+			json:   `{"path":"a.sl","status":"error","error":"oops","variant":"","claim":"","calculated":"","bits":0,"size":0,"corrupt":[]}`,
+		},
+		{
+			result: &batch.Result{Path: "b.sl", Seal: sl, Bytes: 6, Err: cerr},
+			json:   `{"path":"b.sl","status":"broken","error":"` + cerr.Error() + `","variant":"sha512","claim":"abcd","calculated":"abce","bits":16,"size":6,"corrupt":[{"offset":4,"length":2}]}`,
+		},
+	}
+
+	for i, c := range cases {
+		b, err := json.Marshal(newCheckReport(c.result))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != c.json {
+			t.Errorf("case %d: expected %s, got %s", i, c.json, b)
+		}
+	}
+}
+
+// Truncated files and trailing data are broken, as their exit status says.
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	_, malformed := seal.ReadHeader(strings.NewReader("SL%v0{md5:cf83e135}\n"))
+	_, truncated := seal.Unwrap(strings.NewReader("SL%v0{sha256:~32}\nseal!"), ioutil.Discard)
+	_, trailing := seal.Unwrap(strings.NewReader("SL%v0{00} length=0000000000000000000 name=a mode=0644 mtime=2016-07-04T12:30:00Z\n!"), ioutil.Discard)
+
+	cases := []struct {
+		err    error
+		status string
+	}{
+		{nil, StatusOK},
+		{seal.ErrSealBroken, StatusBroken},
+		{truncated, StatusBroken},
+		{trailing, StatusBroken},
+		{seal.ErrBadChunkTable, StatusBroken},
+		{seal.ErrUnrepairable, StatusBroken},
+		{malformed, StatusError},
+		{errors.New("oops"), StatusError},
+	}
+
+	for i, c := range cases {
+		if st := status(c.err); st != c.status {
+			t.Errorf("case %d: expected %s, got %s (%v)", i, c.status, st, c.err)
+		}
+		if broken := batch.IsBroken(c.err); broken != (c.status == StatusBroken) {
+			t.Errorf("case %d: batch.IsBroken is %v (%v)", i, broken, c.err)
+		}
+	}
+}
+
+func TestInfoReport(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		header string
+		json   string
+	}{
+		{
+			"SL%v0{00} length=0000000000000000005 name=a mode=0644 mtime=2016-07-04T12:30:00Z\n",
+			`{"header":"SL%v0{00} length=0000000000000000005 name=a mode=0644 mtime=2016-07-04T12:30:00Z","valid":true,"error":"","magic":"SL%v","version":0,"variant":"sha512","claim":"00","bits":8,"trailer":false,"header_length":81,"content_offset":81,"length":5,"chunk":0,"parity":0,"name":"a","mode":"0644","mtime":"2016-07-04T12:30:00Z"}`,
+		},
+		{"SL%v0{sha256:~32}\n", `{"header":"SL%v0{sha256:~32}","valid":true,"error":"","magic":"SL%v","version":0,"variant":"sha256","claim":"","bits":256,"trailer":true,"header_length":18,"content_offset":18,"length":0,"chunk":0,"parity":0,"name":"","mode":"","mtime":""}`},
+		{"SL%v0{md5:cf83e135}\n", `{"header":"SL%v0{md5:cf83e135}","valid":false,"error":"seal: unknown variant: \"md5\"","magic":"","version":0,"variant":"","claim":"","bits":0,"trailer":false,"header_length":20,"content_offset":20,"length":0,"chunk":0,"parity":0,"name":"","mode":"","mtime":""}`},
+	}
+
+	for i, c := range cases {
+		hi, err := seal.Inspect(strings.NewReader(c.header))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(newInfoReport(hi))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != c.json {
+			t.Errorf("case %d: expected %s, got %s", i, c.json, b)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2016, crasm <crasm@vczf.io>
+// This code is open source under the ISC license. See LICENSE for details.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	seal "github.com/crasm/seal/lib"
+)
+
+// sumEntry is a line of a checksum file, like those written by sha512sum.
+type sumEntry struct {
+	Algo   string // Empty unless the line is BSD-style.
+	Path   string
+	Digest []byte
+}
+
+// The algorithm names used by BSD-style lines, like `SHA512 (path) = ...`.
+var bsdAlgorithms = map[string]string{
+	"SHA256":   seal.VariantSHA256,
+	"SHA512":   seal.VariantSHA512,
+	"SHA3-512": seal.VariantSHA3,
+	"BLAKE2b":  seal.VariantBLAKE2b,
+}
+
+// Parses a checksum file in the format of sha512sum and friends, or the BSD
+// style written by their --tag option. Blank lines are skipped.
+func parseSums(in io.Reader) ([]sumEntry, error) {
+	var entries []sumEntry
+	s := bufio.NewScanner(in)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		e, err := parseSum(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		entries = append(entries, *e)
+	}
+	return entries, s.Err()
+}
+
+func parseSum(line string) (*sumEntry, error) {
+	// Names with a backslash or newline are escaped, and the line starts
+	// with a backslash.
+	escaped := strings.HasPrefix(line, `\`)
+	if escaped {
+		line = line[1:]
+	}
+
+	e := &sumEntry{}
+	var digest string
+	i := strings.Index(line, " (")
+	if i > 0 && !strings.Contains(line[:i], " ") && strings.Contains(line, ") = ") {
+		j := strings.LastIndex(line, ") = ")
+		e.Algo = bsdAlgorithms[line[:i]]
+		if e.Algo == "" {
+			return nil, fmt.Errorf("unknown algorithm: %q", line[:i])
+		}
+		e.Path, digest = line[i+2:j], line[j+4:]
+	} else {
+		i := strings.IndexByte(line, ' ')
+		if i == -1 || len(line) < i+3 || (line[i+1] != ' ' && line[i+1] != '*') {
+			return nil, fmt.Errorf("malformed line: %q", line)
+		}
+		digest, e.Path = line[:i], line[i+2:]
+	}
+
+	if escaped {
+		e.Path = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(e.Path)
+	}
+
+	var err error
+	e.Digest, err = hex.DecodeString(digest)
+	if err != nil || len(e.Digest) == 0 {
+		return nil, fmt.Errorf("invalid digest: %q", digest)
+	}
+	return e, nil
+}
+
+// Returns a line of a checksum file in the format of sha512sum.
+func formatSum(digest []byte, path string) string {
+	if !strings.ContainsAny(path, "\\\n") {
+		return fmt.Sprintf("%x  %s\n", digest, path)
+	}
+	path = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(path)
+	return fmt.Sprintf("\\%x  %s\n", digest, path)
+}
+
+// Returns the algorithm of an entry. Lines that don't name one are assumed to
+// use --algo if its digests are the right length, and otherwise sha256 or
+// sha512.
+func (e *sumEntry) algorithm() (*seal.Algorithm, error) {
+	if e.Algo != "" {
+		return seal.LookupAlgorithm(e.Algo)
+	}
+
+	a, err := seal.LookupAlgorithm(opt.Algo)
+	if err == nil && a.MaxBytes == len(e.Digest) {
+		return a, nil
+	}
+	switch len(e.Digest) {
+	case 32:
+		return seal.LookupAlgorithm(seal.VariantSHA256)
+	case 64:
+		return seal.LookupAlgorithm(seal.VariantSHA512)
+	default:
+		return nil, fmt.Errorf("no algorithm has %d byte digests", len(e.Digest))
+	}
+}
+
+// Seals every file listed in a checksum file with a full-length claim, once
+// it's confirmed that the file still has its recorded digest. Relative paths
+// are relative to the checksum file. Returns the exit status.
+func fromSums(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		fail(err)
+	}
+	entries, err := parseSums(f)
+	f.Close()
+	if err != nil {
+		fail(fmt.Errorf("%s: %w", path, err))
+	}
+
+	t := &tally{}
+	for _, e := range entries {
+		file := filepath.FromSlash(e.Path)
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		t.add(file, sealFromSum(file, &e))
+	}
+
+	fmt.Fprintf(reporter(os.Stdout), "%d ok, %d broken, %d errored\n",
+		t.ok, t.broken, t.errored)
+	return t.code
+}
+
+func sealFromSum(path string, e *sumEntry) error {
+	a, err := e.algorithm()
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := createOutput(path+FileExtension, opt.Force)
+	if err == nil {
+		var sl *seal.Seal
+		sl, err = seal.Wrap(in, out, seal.WithAlgorithm(a.Name))
+		if err == nil && !bytes.Equal(sl.ClaimedSignature, e.Digest) {
+			err = seal.ErrSealBroken
+		}
+	}
+	if err == nil {
+		err = preserveAttributes(in, out.File)
+	}
+	return out.finish(err)
+}
+
+// Writes a checksum file in the format of sha512sum (or the sum tool for
+// --algo) listing the content of each seal. Returns the exit status.
+func toSums(args []string) int {
+	a, err := seal.LookupAlgorithm(opt.Algo)
+	if err != nil {
+		fail(err)
+	}
+
+	buf := &bytes.Buffer{}
+	code := ExitOK
+	report := func(path string, err error) {
+		if c := exitCode(err); c > code {
+			code = c
+		}
+		fmt.Fprintf(reporter(os.Stderr), "%s: ERROR (%v)\n", path, err)
+	}
+
+	w := &walker{cmd: ToSums, visit: func(path string, err error) {
+		var claim []byte
+		if err == nil {
+			claim, err = contentDigest(path, a)
+		}
+		if err != nil {
+			report(path, err)
+			return
+		}
+		buf.WriteString(formatSum(claim, strings.TrimSuffix(path, FileExtension)))
+	}}
+	for _, arg := range args {
+		err := w.walkArg(arg)
+		if err != nil {
+			report(arg, err)
+		}
+	}
+
+	out, err := createOutput(outputOrStdout(), true)
+	if err == nil {
+		_, err = buf.WriteTo(out)
+	}
+	err = out.finish(err)
+	if err != nil {
+		fail(err)
+	}
+	return code
+}
+
+// Returns the digest of the content of the seal at path with algorithm a.
+// That's the claim if it's a full-length digest of the content alone, which
+// is taken on trust like the header of any checksum file. Otherwise, as for
+// seals with metadata, the seal is verified while the content is hashed.
+func contentDigest(path string, a *seal.Algorithm) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sl, err := seal.ReadHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	if sl.VariantName() == a.Name && sl.Metadata == nil && sl.TrailerLen == 0 &&
+		len(sl.ClaimedSignature) == a.MaxBytes {
+		return sl.ClaimedSignature, nil
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	h := a.New()
+	_, err = unwrap(f, h)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func outputOrStdout() string {
+	if opt.Output == "" {
+		return stdout
+	}
+	return opt.Output
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSums(t *testing.T) {
+	t.Parallel()
+
+	digest := strings.Repeat("ab", 64)
+	sums := strings.Join([]string{
+		digest + "  plain",
+		digest + " *binary",
+		"",
+		`\` + digest + `  back\\slash\nnewline`,
+		"SHA256 (a (b) = c) = " + strings.Repeat("cd", 32),
+		digest + "  name (with) = parens",
+	}, "\n")
+
+	cases := []sumEntry{
+		{"", "plain", nil},
+		{"", "binary", nil},
+		{"", "back\\slash\nnewline", nil},
+		{"sha256", "a (b) = c", nil},
+		{"", "name (with) = parens", nil},
+	}
+
+	entries, err := parseSums(strings.NewReader(sums + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(cases) {
+		t.Fatalf("expected %d entries, got %d", len(cases), len(entries))
+	}
+	for i, c := range cases {
+		e := entries[i]
+		if e.Algo != c.Algo || e.Path != c.Path {
+			t.Errorf("case %d: expected %q %q, got %q %q", i, c.Algo, c.Path, e.Algo, e.Path)
+		}
+		if e.Algo == "" && hex.EncodeToString(e.Digest) != digest {
+			t.Errorf("case %d: wrong digest %x", i, e.Digest)
+		}
+	}
+}
+
+func TestParseSumsBad(t *testing.T) {
+	t.Parallel()
+
+	for i, sums := range []string{
+		"abcd",
+		"abcd plain",
+		"xyz  plain",
+		"  plain",
+		"MD5 (plain) = abcd",
+	} {
+		_, err := parseSums(bytes.NewBufferString(sums))
+		if err == nil {
+			t.Errorf("case %d: expected an error for %q", i, sums)
+		}
+	}
+}
+
+func TestFormatSum(t *testing.T) {
+	t.Parallel()
+
+	for i, path := range []string{"plain", "back\\slash\nnewline", "name (with) = parens"} {
+		line := formatSum([]byte{0xab}, path)
+		entries, err := parseSums(strings.NewReader(line))
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if len(entries) != 1 || entries[0].Path != path {
+			t.Errorf("case %d: %q doesn't round trip", i, line)
+		}
+	}
+}
+
+// Seals made with the default flags record metadata, so the claim isn't a
+// digest of the content alone, but they still round trip through a checksum
+// file, which may list absolute paths.
+func TestSumsRoundTrip(t *testing.T) {
+	saved := opt
+	defer func() { opt = saved }()
+	opt.Algo, opt.Size, opt.Chunk = "sha512", 512, 1<<20
+	opt.Quiet = true
+
+	dir, err := ioutil.TempDir("", "seal-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "abs.txt")
+	content := []byte("seal!\n")
+	err = ioutil.WriteFile(path, content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = run(Wrap, path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sums := filepath.Join(dir, "SHA512SUMS")
+	opt.Output = sums
+	code := toSums([]string{path + FileExtension})
+	opt.Output = ""
+	if code != ExitOK {
+		t.Fatalf("expected exit status %d, got %d", ExitOK, code)
+	}
+	digest := sha512.Sum512(content)
+	data, err := ioutil.ReadFile(sums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := formatSum(digest[:], path); string(data) != expected {
+		t.Errorf("expected %q, got %q", expected, data)
+	}
+
+	// The checksum file is elsewhere, but the path in it is absolute.
+	other, err := ioutil.TempDir("", "seal-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(other)
+	err = os.Rename(sums, filepath.Join(other, "SHA512SUMS"))
+	if err == nil {
+		err = os.Remove(path + FileExtension)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	code = fromSums(filepath.Join(other, "SHA512SUMS"))
+	if code != ExitOK {
+		t.Fatalf("expected exit status %d, got %d", ExitOK, code)
+	}
+	_, err = os.Stat(path + FileExtension)
+	if err != nil {
+		t.Error(err)
+	}
+}
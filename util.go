@@ -3,6 +3,12 @@
 
 package main
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // True if at most one is true. All can be false.
 func isMutuallyExclusive(bools ...bool) bool {
 	found := 0
@@ -13,3 +19,12 @@ func isMutuallyExclusive(bools ...bool) bool {
 	}
 	return found <= 1
 }
+
+// Parses a whole percentage such as "5%". The percent sign is optional.
+func parsePercent(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+	if err != nil || n < 0 || n > 100 {
+		return 0, usageError(fmt.Sprintf("invalid percentage: %q", s))
+	}
+	return n, nil
+}
@@ -46,3 +46,28 @@ func TestIsMutuallyExclusive(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePercent(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		s      string
+		answer int
+		ok     bool
+	}{
+		{"5%", 5, true},
+		{"5", 5, true},
+		{"100%", 100, true},
+		{"101%", 0, false},
+		{"-1%", 0, false},
+		{"5.5%", 0, false},
+		{"%", 0, false},
+	}
+
+	for i, c := range cases {
+		n, err := parsePercent(c.s)
+		if (err == nil) != c.ok || n != c.answer {
+			t.Errorf("case %d: expected %d, got %d (%v)", i, c.answer, n, err)
+		}
+	}
+}